@@ -0,0 +1,117 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// memoryRange is the memory referenced by a slice, [start, end) of its backing array, or by a map, which is
+// identified by its start only.
+type memoryRange struct {
+	start, end uintptr
+}
+
+// aliasError returns an error listing the dst paths of the slices and maps that share their backing arrays or maps
+// with the slices and maps reachable from src. The slices overlapping with a src slice, e.g. src[1:], are reported
+// as well.
+func aliasError(src, dst interface{}, o *options) error {
+	var srcRanges []memoryRange
+	walkReferences(reflect.ValueOf(src), "", nil, make(map[uintptr]bool), func(v reflect.Value, _ string) {
+		srcRanges = append(srcRanges, referencedRange(v))
+	})
+
+	var aliased []string
+	walkReferences(reflect.ValueOf(dst), "", o, make(map[uintptr]bool), func(v reflect.Value, path string) {
+		r := referencedRange(v)
+		for _, srcRange := range srcRanges {
+			if r.start < srcRange.end && srcRange.start < r.end {
+				aliased = append(aliased, path)
+				return
+			}
+		}
+	})
+	if len(aliased) > 0 {
+		return errors.Errorf("dst fields %s share their memory with src", strings.Join(aliased, ", "))
+	}
+	return nil
+}
+
+// referencedRange returns the memory referenced by the slice or map `v`.
+func referencedRange(v reflect.Value) memoryRange {
+	start := v.Pointer()
+	if v.Kind() == reflect.Map {
+		return memoryRange{start: start, end: start + 1}
+	}
+	return memoryRange{start: start, end: start + uintptr(v.Cap())*v.Type().Elem().Size()}
+}
+
+// walkReferences calls `visit` for every non-empty slice and non-nil map reachable from `v` through the exported
+// fields. The slices without capacity or with zero-sized items are not visited: they may all point to the same
+// zero-sized allocation. The paths are built with the dst field names of `o`, or with the Go field names if `o` is
+// nil.
+func walkReferences(
+	v reflect.Value,
+	path string,
+	o *options,
+	visited map[uintptr]bool,
+	visit func(v reflect.Value, path string),
+) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || visited[v.Pointer()] {
+			return
+		}
+		visited[v.Pointer()] = true
+		walkReferences(v.Elem(), path, o, visited, visit)
+
+	case reflect.Interface:
+		if !v.IsNil() {
+			walkReferences(v.Elem(), path, o, visited, visit)
+		}
+
+	case reflect.Struct:
+		var names map[string]string
+		if o != nil {
+			names = make(map[string]string)
+			for maskName, goName := range o.dstFieldMapping(v) {
+				names[goName] = maskName
+			}
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name, ok := names[field.Name]
+			if !ok {
+				name = field.Name
+			}
+			walkReferences(v.Field(i), joinPath(path, name), o, visited, visit)
+		}
+
+	case reflect.Slice:
+		if v.Cap() == 0 || v.Type().Elem().Size() == 0 {
+			return
+		}
+		visit(v, path)
+		for i := 0; i < v.Len(); i++ {
+			walkReferences(v.Index(i), path, o, visited, visit)
+		}
+
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkReferences(v.Index(i), path, o, visited, visit)
+		}
+
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		visit(v, path)
+		for _, key := range v.MapKeys() {
+			walkReferences(v.MapIndex(key), joinPath(path, mapKeyString(key)), o, visited, visit)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package fieldmask_utils
+
+import (
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/pkg/errors"
+)
+
+// AnyResolver resolves the type URL of a google.protobuf.Any to an empty message of that type.
+// It is compatible with jsonpb.AnyResolver.
+type AnyResolver interface {
+	Resolve(typeURL string) (proto.Message, error)
+}
+
+// WithAnyResolver makes StructToStruct filter the messages packed into the google.protobuf.Any fields: the message
+// is unpacked, copied with the filter registered for its type and packed again into the dst Any.
+// The `filters` are keyed by either the full type URL or the message name, e.g. "google.protobuf.Timestamp".
+// The Any values of other types are copied as usual. If `resolver` is nil the messages are resolved with the
+// golang/protobuf registry.
+func WithAnyResolver(resolver AnyResolver, filters map[string]FieldFilter) Option {
+	return func(o *options) {
+		o.anyResolver = resolver
+		o.anyFilters = filters
+	}
+}
+
+// anyToStruct copies the message packed into `src` to the dst Any filtering it with the filter registered for
+// its type. It returns false if there is no such filter or `dst` is not an Any.
+func anyToStruct(src *any.Any, dst interface{}, path string, o *options) (bool, error) {
+	dstAny, ok := dst.(*any.Any)
+	if !ok || src == nil {
+		return false, nil
+	}
+	filter, ok := o.anyFilters[src.GetTypeUrl()]
+	if !ok {
+		filter, ok = o.anyFilters[src.GetTypeUrl()[strings.LastIndex(src.GetTypeUrl(), "/")+1:]]
+	}
+	if !ok {
+		return false, nil
+	}
+
+	msg, err := o.resolveAny(src)
+	if err != nil {
+		return true, errors.Wrapf(err, "failed to resolve the type %s of the field %s", src.GetTypeUrl(), path)
+	}
+	if err := proto.Unmarshal(src.GetValue(), msg); err != nil {
+		return true, errors.Wrapf(err, "failed to unpack the field %s", path)
+	}
+	filtered := proto.Clone(msg)
+	filtered.Reset()
+	if err := structToStruct(filter, msg, filtered, path, o); err != nil {
+		return true, err
+	}
+	value, err := proto.Marshal(filtered)
+	if err != nil {
+		return true, errors.Wrapf(err, "failed to pack the field %s", path)
+	}
+	dstAny.TypeUrl = src.GetTypeUrl()
+	dstAny.Value = value
+	return true, nil
+}
+
+// resolveAny returns an empty message of the type packed into `src`.
+func (o *options) resolveAny(src *any.Any) (proto.Message, error) {
+	if o.anyResolver != nil {
+		return o.anyResolver.Resolve(src.GetTypeUrl())
+	}
+	var dynamic ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(src, &dynamic); err != nil {
+		return nil, err
+	}
+	dynamic.Message.Reset()
+	return dynamic.Message, nil
+}
@@ -0,0 +1,51 @@
+package fieldmask_utils_test
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timestampResolver struct{}
+
+func (timestampResolver) Resolve(typeURL string) (proto.Message, error) {
+	return &timestamp.Timestamp{}, nil
+}
+
+func TestStructToStructWithAnyResolver(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,details")
+	for name, resolver := range map[string]fieldmask_utils.AnyResolver{
+		"registry": nil,
+		"custom":   timestampResolver{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dst := &testproto.User{}
+			err := fieldmask_utils.StructToStruct(mask, testUserFull, dst,
+				fieldmask_utils.WithAnyResolver(resolver, map[string]fieldmask_utils.FieldFilter{
+					"google.protobuf.Timestamp": fieldmask_utils.MaskFromString("seconds"),
+				}))
+			require.NoError(t, err)
+			require.Len(t, dst.Details, 1)
+			assert.Equal(t, testUserFull.Details[0].TypeUrl, dst.Details[0].TypeUrl)
+
+			ts := &timestamp.Timestamp{}
+			require.NoError(t, ptypes.UnmarshalAny(dst.Details[0], ts))
+			assert.Equal(t, &timestamp.Timestamp{Seconds: 5}, ts)
+		})
+	}
+
+	// The Any values without a registered filter are copied as is.
+	dst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, dst,
+		fieldmask_utils.WithAnyResolver(nil, map[string]fieldmask_utils.FieldFilter{
+			"example.com/example/Image": fieldmask_utils.MaskFromString("original_url"),
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, testUserFull.Details, dst.Details)
+}
@@ -1,12 +1,16 @@
 package fieldmask_utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes/any"
 	"github.com/pkg/errors"
+	"google.golang.org/genproto/protobuf/field_mask"
 )
 
 func ProtoToStruct(
@@ -19,17 +23,247 @@ func ProtoToStruct(
 		return err
 	}
 
-	return StructToStruct(filter, src, dst)
+	return StructToStruct(filter, src, dst, opts...)
 }
 
 // StructToStruct copies `src` struct to `dst` struct using the given FieldFilter.
 // Only the fields where FieldFilter returns true will be copied to `dst`.
 // `src` and `dst` must be coherent in terms of the field names, but it is not required for them to be of the same type.
-func StructToStruct(filter FieldFilter, src, dst interface{}) error {
+// `opts` may contain Option values that modify the copying behavior.
+// `dst` may also be a pointer to an interface (e.g. *interface{}) holding a pointer to a struct: the struct it holds
+// is copied to.
+func StructToStruct(filter FieldFilter, src, dst interface{}, opts ...interface{}) error {
+	o := newOptions(opts)
+	if isNil(src) {
+		return o.nilSrcError()
+	}
+
+	dst = dynamicDst(dst)
+	dstVal := reflect.ValueOf(dst)
+	if !o.atomic || dstVal.Kind() != reflect.Ptr || dstVal.IsNil() {
+		return rootStructToStruct(filter, src, dst, o)
+	}
+
+	// Copy to a shallow copy of dst and only commit the result on success.
+	tmp := reflect.New(dstVal.Elem().Type())
+	tmp.Elem().Set(dstVal.Elem())
+	if err := rootStructToStruct(filter, src, tmp.Interface(), o); err != nil {
+		return err
+	}
+	dstVal.Elem().Set(tmp.Elem())
+	return nil
+}
+
+func rootStructToStruct(filter FieldFilter, src, dst interface{}, o *options) error {
+	if indirect(reflect.ValueOf(src)).Kind() != reflect.Struct {
+		return errors.Errorf("src must be a struct or a pointer to a struct, got %s", typeName(reflect.TypeOf(src)))
+	}
+	// The fields of a dst passed by value can not be set: fail early rather than on the first copied field.
+	// FieldSetter implementations set the fields themselves.
+	dstVal := reflect.ValueOf(dst)
+	if _, isSetter := dst.(FieldSetter); !isSetter {
+		if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() {
+			return errors.Errorf("dst must be a non-nil pointer to a struct, got %s: was dst passed by value?",
+				typeName(reflect.TypeOf(dst)))
+		}
+		if indirect(dstVal).Kind() != reflect.Struct {
+			return errors.Errorf("dst must be a non-nil pointer to a struct, got %s", typeName(reflect.TypeOf(dst)))
+		}
+	}
+	filter = o.rootFilter(filter)
+	if err := cycleError(filter); err != nil {
+		return err
+	}
+	if o.resetDst && dstVal.Kind() == reflect.Ptr && !dstVal.IsNil() {
+		dstVal.Elem().Set(reflect.Zero(dstVal.Elem().Type()))
+	}
+	if err := structToStruct(filter, src, dst, "", o); err != nil {
+		return err
+	}
+	if err := o.collectedErrors(); err != nil {
+		return err
+	}
+	if o.noAlias {
+		if err := aliasError(src, dst, o); err != nil {
+			return err
+		}
+	}
+	return o.coverageError()
+}
+
+// Clone creates a new value of the same type as `src` and copies `src` to it using StructToStruct.
+// If `src` is a pointer to a struct, the result is a pointer to a new struct, otherwise it's a struct value.
+func Clone(filter FieldFilter, src interface{}, opts ...interface{}) (interface{}, error) {
+	srcType := reflect.TypeOf(src)
+	if srcType == nil {
+		return nil, errors.New("src must not be nil")
+	}
+	isPtr := srcType.Kind() == reflect.Ptr
+	if isPtr {
+		srcType = srcType.Elem()
+	}
+	if srcType.Kind() != reflect.Struct {
+		return nil, errors.Errorf("src must be a struct or a pointer to a struct, got %T", src)
+	}
+
+	dst := reflect.New(srcType)
+	if err := StructToStruct(filter, src, dst.Interface(), opts...); err != nil {
+		return nil, err
+	}
+	if isPtr {
+		return dst.Interface(), nil
+	}
+	return dst.Elem().Interface(), nil
+}
+
+// StructSliceToStructSlice copies every item of the `src` slice of structs (or pointers to structs) to a new item of
+// the slice `dstSlicePtr` points to using StructToStruct. The dst slice is replaced with a slice of the same length
+// as `src`: nil src items result in nil (or zero) dst items, a nil src slice results in a nil dst slice.
+func StructSliceToStructSlice(filter FieldFilter, src, dstSlicePtr interface{}, opts ...interface{}) error {
+	srcVal := reflect.ValueOf(src)
+	if srcVal.Kind() != reflect.Slice {
+		return errors.Errorf("src must be a slice, got %s", typeName(reflect.TypeOf(src)))
+	}
+	dstVal := reflect.ValueOf(dstSlicePtr)
+	if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() || dstVal.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("dst must be a pointer to a slice, got %s", typeName(reflect.TypeOf(dstSlicePtr)))
+	}
+	dstType := dstVal.Elem().Type()
+	itemType := indirectType(dstType.Elem())
+	if itemType.Kind() != reflect.Struct {
+		return errors.Errorf("dst items must be structs or pointers to structs, got %s", typeName(dstType.Elem()))
+	}
+	if srcVal.IsNil() {
+		dstVal.Elem().Set(reflect.Zero(dstType))
+		return nil
+	}
+
+	result := reflect.MakeSlice(dstType, srcVal.Len(), srcVal.Len())
+	for i := 0; i < srcVal.Len(); i++ {
+		srcItem := srcVal.Index(i)
+		if srcItem.Kind() == reflect.Ptr && srcItem.IsNil() {
+			continue
+		}
+		dstItem := reflect.New(itemType)
+		if err := StructToStruct(filter, srcItem.Interface(), dstItem.Interface(), opts...); err != nil {
+			return errors.Wrapf(err, "failed to copy the item %d", i)
+		}
+		if dstType.Elem().Kind() == reflect.Ptr {
+			result.Index(i).Set(dstItem)
+		} else {
+			result.Index(i).Set(dstItem.Elem())
+		}
+	}
+	dstVal.Elem().Set(result)
+	return nil
+}
+
+// CopyCommonFields copies the fields that are present in both `src` and `dst` using StructToStruct. The fields
+// that are missing on either side are skipped, nested messages of distinct types are copied the same way.
+// `dst` is left untouched if the types have no fields in common.
+func CopyCommonFields(src, dst interface{}, opts ...interface{}) error {
+	srcType, dstType := reflect.TypeOf(src), reflect.TypeOf(dst)
+	if srcType == nil || dstType == nil {
+		return errors.New("src and dst must not be nil")
+	}
+	srcType, dstType = indirectType(srcType), indirectType(dstType)
+	if srcType.Kind() != reflect.Struct || dstType.Kind() != reflect.Struct {
+		return errors.Errorf("can not copy common fields of %s to %s", typeName(srcType), typeName(dstType))
+	}
+
+	mask := commonFieldsMask(srcType, dstType, newOptions(opts))
+	if len(mask) == 0 {
+		return nil
+	}
+	return StructToStruct(mask, src, dst, opts...)
+}
+
+// commonFieldsMask returns a Mask that selects the fields present in both struct types.
+func commonFieldsMask(srcType, dstType reflect.Type, o *options) Mask {
+	srcFields := o.fieldMapping(reflect.New(srcType).Elem(), false)
+	dstFields := o.dstFieldMapping(reflect.New(dstType).Elem())
+
+	mask := make(Mask)
+	for i := 0; i < srcType.NumField(); i++ {
+		srcField := srcType.Field(i)
+		name, ok := srcFields[srcField.Name]
+		if !ok {
+			continue
+		}
+		dstFieldName, ok := dstFields[name]
+		if !ok {
+			continue
+		}
+		dstField, _ := dstType.FieldByName(dstFieldName)
+
+		srcElem, dstElem := messageType(srcField.Type), messageType(dstField.Type)
+		if srcElem == nil || dstElem == nil || srcElem == dstElem {
+			mask[name] = Mask{}
+			continue
+		}
+		// Only select the common fields of the distinct nested messages.
+		if subMask := commonFieldsMask(srcElem, dstElem, o); len(subMask) > 0 {
+			mask[name] = subMask
+		}
+	}
+	return mask
+}
+
+// messageType returns the struct type of a field of a message, a slice of messages or a map of messages type `t`.
+// It returns nil for the other types.
+func messageType(t reflect.Type) reflect.Type {
+	t = indirectType(t)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		t = indirectType(t.Elem())
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// StructToStructIfChanged copies `src` to `dst` the same way StructToStruct does, but only modifies `dst` if the
+// result differs from it. It reports whether `dst` has changed. `dst` must be a non-nil pointer to a struct.
+func StructToStructIfChanged(filter FieldFilter, src, dst interface{}, opts ...interface{}) (bool, error) {
+	dstVal := reflect.ValueOf(dst)
+	if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() || dstVal.Elem().Kind() != reflect.Struct {
+		return false, errors.Errorf("dst must be a non-nil pointer to a struct, got %T", dst)
+	}
+
+	// Copy to a shallow copy of dst and compare the result to the original.
+	tmp := reflect.New(dstVal.Elem().Type())
+	tmp.Elem().Set(dstVal.Elem())
+	if err := StructToStruct(filter, src, tmp.Interface(), opts...); err != nil {
+		return false, err
+	}
+	if reflect.DeepEqual(tmp.Elem().Interface(), dstVal.Elem().Interface()) {
+		return false, nil
+	}
+	dstVal.Elem().Set(tmp.Elem())
+	return true, nil
+}
+
+func structToStruct(filter FieldFilter, src, dst interface{}, path string, o *options) error {
+	if srcAny, ok := src.(*any.Any); ok && o.anyFilters != nil {
+		if ok, err := anyToStruct(srcAny, dst, path, o); ok || err != nil {
+			return err
+		}
+	}
 	srcVal := indirect(reflect.ValueOf(src))
-	dstVal := indirect(reflect.ValueOf(dst))
-	srcFields := getFieldMappingFromTags(srcVal, false)
-	dstFields := getFieldMappingFromTags(dstVal, true)
+	srcFields := o.fieldMapping(srcVal, false)
+	setter, isSetter := dst.(FieldSetter)
+	var dstFields map[string]string
+	if !isSetter {
+		dstVal := indirect(reflect.ValueOf(dst))
+		dstFields = o.dstFieldMapping(dstVal)
+		if o.matchByFieldNumber {
+			dstFields = fieldNumberMapping(srcVal.Type(), dstVal.Type(), srcFields, dstFields)
+		}
+	}
+	if o.logger != nil && path != "" {
+		o.logger("entering %s", path)
+	}
 
 	for i := 0; i < srcVal.NumField(); i++ {
 		fieldName := srcVal.Type().Field(i).Name
@@ -40,138 +274,835 @@ func StructToStruct(filter FieldFilter, src, dst interface{}) error {
 		srcFieldName := srcFields[fieldName]
 
 		subFilter, ok := filter.Filter(srcFieldName)
+		if ok && o.stopPaths != nil && o.stopPaths[joinPath(path, srcFieldName)] {
+			continue
+		}
 		if !ok {
 			// Skip this field.
+			if o.logger != nil || o.requireFullCoverage {
+				o.skip(joinPath(path, srcFieldName))
+			}
 			continue
 		}
 
-		if _, ok := dstFields[srcFieldName]; !ok {
-			return errors.Errorf("target field %s is not present in dst struct", srcFieldName)
+		srcField, err := o.srcField(src, fieldName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the field %s from %s", fieldName, typeName(reflect.TypeOf(src)))
 		}
 
-		srcField, err := getField(src, fieldName)
+		fieldPath := joinPath(path, srcFieldName)
+		if o.logger != nil {
+			o.logger("copying %s", fieldPath)
+		}
+		if srcField, err = o.applyDefault(srcField, fieldPath); err != nil {
+			return err
+		}
+		if isSetter {
+			err = fieldToSetter(subFilter, srcField, srcFieldName, setter, fieldPath, o)
+		} else {
+			err = fieldToStruct(subFilter, srcField, srcFieldName, dst, dstFields, fieldPath, o)
+		}
 		if err != nil {
-			return errors.Wrapf(err, "failed to get the field %s from %T", fieldName, src)
+			if !o.bestEffort {
+				return err
+			}
+			o.errors = append(o.errors, err)
+		}
+	}
+	return nil
+}
+
+// FieldSetter is implemented by the dynamic dst types (e.g. map based containers) that set their fields themselves.
+// StructToStruct passes the values of the selected src fields to SetField instead of setting the dst fields with
+// reflection: the messages are filtered copies of the src messages, other values are passed as is.
+type FieldSetter interface {
+	SetField(name string, value interface{}) error
+}
+
+// fieldToSetter passes the `srcField` found at `fieldPath` to the FieldSetter dst.
+func fieldToSetter(
+	subFilter FieldFilter,
+	srcField reflect.Value,
+	srcFieldName string,
+	setter FieldSetter,
+	fieldPath string,
+	o *options,
+) error {
+	if isUnsupportedKind(srcField.Kind()) {
+		if o.errorOnUnsupported {
+			return errors.Errorf("field %s of kind %s can not be copied", fieldPath, srcField.Kind())
+		}
+		return nil
+	}
+	value := srcField
+	if srcField.Kind() == reflect.Ptr && !srcField.IsNil() && srcField.Elem().Kind() == reflect.Struct &&
+		!o.isOpaque(srcField.Type()) {
+		value = reflect.New(srcField.Type().Elem())
+		if err := structToStruct(subFilter, srcField.Interface(), value.Interface(), fieldPath, o); err != nil {
+			return err
+		}
+	}
+	if err := setter.SetField(srcFieldName, value.Interface()); err != nil {
+		return errors.Wrapf(err, "failed to set the field %s", fieldPath)
+	}
+	return nil
+}
+
+// fieldToStruct copies the `srcField` found at `fieldPath` to the corresponding field of `dst`.
+func fieldToStruct(
+	subFilter FieldFilter,
+	srcField reflect.Value,
+	srcFieldName string,
+	dst interface{},
+	dstFields map[string]string,
+	fieldPath string,
+	o *options,
+) error {
+	if isUnsupportedKind(srcField.Kind()) {
+		if o.errorOnUnsupported {
+			return errors.Errorf("field %s of kind %s can not be copied", fieldPath, srcField.Kind())
 		}
-		dstField, err := getField(dst, dstFields[srcFieldName])
+		return nil
+	}
+
+	dstFieldName := srcFieldName
+	if o.dstName != nil {
+		dstFieldName = o.dstName(fieldPath)
+	}
+
+	if _, ok := dstFields[dstFieldName]; !ok {
+		if o.unwrapOneof && srcField.Kind() == reflect.Interface {
+			// Copy the fields of the oneof wrapper to dst itself.
+			if srcField.IsNil() {
+				return nil
+			}
+			if indirect(srcField.Elem()).Kind() != reflect.Struct {
+				return errors.Errorf("oneof field %s of type %s can not be unwrapped", fieldPath, srcField.Elem().Type())
+			}
+			return structToStruct(subFilter, srcField.Elem().Interface(), dst, fieldPath, o)
+		}
+		return errors.Errorf("target field %s is not present in dst %s", dstFieldName, typeName(reflect.TypeOf(dst)))
+	}
+
+	dstField, err := getField(dst, dstFields[dstFieldName])
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the field %s from %T", dstFieldName, dst)
+	}
+	if !dstField.CanSet() {
+		return errors.Errorf("can't set a value on a field %s", dstFieldName)
+	}
+
+	dstFieldType := dstField.Type()
+
+	if adapt, ok := o.adapters[adapterKey{src: srcField.Type(), dst: dstFieldType}]; ok {
+		value, err := adapt(srcField)
 		if err != nil {
-			return errors.Wrapf(err, "failed to get the field %s from %T", fieldName, dst)
+			return errors.Wrapf(err, "failed to convert the field %s to %s", fieldPath, dstFieldType)
 		}
-		if !dstField.CanSet() {
-			return errors.Errorf("can't set a value on a field %s", fieldName)
+		dstField.Set(value)
+		return nil
+	}
+
+	if o.rawJSON && dstFieldType == rawMessageType && !srcField.Type().AssignableTo(dstFieldType) {
+		return fieldToRawJSON(subFilter, srcField, dstField, fieldPath, o)
+	}
+
+	if o.isOpaque(srcField.Type()) {
+		return opaqueToStruct(srcField, dstField, fieldPath)
+	}
+
+	if o.mapEntryPaths[fieldPath] && dstFieldType.Kind() == reflect.Map {
+		return mapEntriesToMap(srcField, dstField, fieldPath, o)
+	}
+
+	srcIsSequence := srcField.Kind() == reflect.Slice || srcField.Kind() == reflect.Array
+	dstIsSequence := dstFieldType.Kind() == reflect.Slice || dstFieldType.Kind() == reflect.Array
+	switch {
+	case o.scalarToSlice && dstFieldType.Kind() == reflect.Slice && !srcIsSequence:
+		// Wrap the single src value into a one-element slice.
+		if srcField.Kind() == reflect.Ptr && srcField.IsNil() {
+			dstField.Set(reflect.Zero(dstFieldType))
+			return nil
 		}
+		items := reflect.MakeSlice(reflect.SliceOf(srcField.Type()), 1, 1)
+		items.Index(0).Set(srcField)
+		return sliceToStruct(subFilter, items, dstField, fieldPath, o)
 
-		dstFieldType := dstField.Type()
+	case o.sliceToScalar && srcIsSequence && !dstIsSequence && dstFieldType.Kind() != reflect.Interface:
+		// Copy the first src item, if any.
+		if srcField.Len() == 0 {
+			dstField.Set(reflect.Zero(dstFieldType))
+			return nil
+		}
+		srcField = srcField.Index(0)
+	}
 
-		switch dstFieldType.Kind() {
-		case reflect.Interface:
+	switch dstFieldType.Kind() {
+	case reflect.Interface:
+		switch srcField.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
 			if srcField.IsNil() {
 				dstField.Set(reflect.Zero(dstFieldType))
-				continue
+				return nil
+			}
+		}
+		if !srcField.Type().Implements(dstFieldType) {
+			// The oneof wrappers of another generator are copied to the registered dst wrappers.
+			wrapper, ok := o.oneofWrapperFor(srcField, dstFieldType)
+			if !ok {
+				return errors.Errorf("src %s does not implement dst %s", srcField.Type(), dstFieldType)
 			}
-			if !srcField.Type().Implements(dstFieldType) {
-				return errors.Errorf("src %T does not implement dst %T",
-					srcField.Interface(), dstField.Interface())
+			v := reflect.New(wrapper.Elem())
+			if err := structToStruct(subFilter, srcField.Interface(), v.Interface(), fieldPath, o); err != nil {
+				return err
 			}
+			dstField.Set(v)
+			return nil
+		}
 
-			v := reflect.New(srcField.Elem().Elem().Type())
-			if err := StructToStruct(subFilter, srcField.Interface(), v.Interface()); err != nil {
+		// The concrete value may be either a pointer (e.g. golang/protobuf oneof wrappers) or a value of any kind
+		// that is boxed into the dst interface.
+		srcElem := srcField
+		if srcElem.Kind() == reflect.Interface {
+			srcElem = srcElem.Elem()
+		}
+		switch {
+		case srcElem.Kind() == reflect.Ptr && srcElem.Elem().Kind() == reflect.Struct:
+			v := reflect.New(srcElem.Elem().Type())
+			if err := structToStruct(subFilter, srcElem.Interface(), v.Interface(), fieldPath, o); err != nil {
 				return err
 			}
 			dstField.Set(v)
 
-		case reflect.Ptr:
-			switch srcField.Type().Kind() {
-			case reflect.Ptr, reflect.Interface:
-				if srcField.IsNil() {
-					dstField.Set(reflect.Zero(dstFieldType))
-					continue
-				}
+		case srcElem.Kind() == reflect.Struct && (isMessageType(srcElem.Type()) || isDeepMask(subFilter)):
+			// Other struct values, e.g. time.Time, are boxed as a whole by the default case.
+			v := reflect.New(srcElem.Type())
+			if err := structToStruct(subFilter, srcElem.Interface(), v.Interface(), fieldPath, o); err != nil {
+				return err
+			}
+			dstField.Set(v.Elem())
 
-				v := reflect.New(dstFieldType.Elem())
-				if err := StructToStruct(subFilter, srcField.Interface(), v.Interface()); err != nil {
+		case srcElem.Kind() == reflect.Slice || srcElem.Kind() == reflect.Array:
+			v := reflect.New(srcElem.Type()).Elem()
+			if err := sliceToStruct(subFilter, srcElem, v, fieldPath, o); err != nil {
+				return err
+			}
+			dstField.Set(v)
+
+		case srcElem.Kind() == reflect.Map && indirectType(srcElem.Type().Elem()).Kind() == reflect.Struct:
+			v := reflect.New(srcElem.Type()).Elem()
+			if err := mapToStruct(subFilter, srcElem, v, fieldPath, o); err != nil {
+				return err
+			}
+			dstField.Set(v)
+
+		default:
+			dstField.Set(srcElem)
+		}
+
+	case reflect.Ptr:
+		switch srcField.Type().Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if srcField.IsNil() {
+				dstField.Set(reflect.Zero(dstFieldType))
+				return nil
+			}
+
+			v := reflect.New(dstFieldType.Elem())
+			if srcField.Kind() == reflect.Ptr && srcField.Elem().Kind() != reflect.Struct {
+				// A pointer to a scalar, e.g. a proto3 optional field.
+				value, err := convertScalar(srcField.Elem(), dstFieldType.Elem(), fieldPath, o)
+				if err != nil {
 					return err
 				}
+				v.Elem().Set(value)
 				dstField.Set(v)
+				return nil
+			}
+			if clone, ok := o.protoCloneOf(subFilter, srcField, dstFieldType); ok {
+				dstField.Set(clone)
+				return nil
+			}
+			if err := structToStruct(subFilter, srcField.Interface(), v.Interface(), fieldPath, o); err != nil {
+				return err
+			}
+			dstField.Set(v)
 
-			default:
+		case reflect.Struct:
+			if isDeepMask(subFilter) || isMessageType(srcField.Type()) || isMessageType(dstFieldType.Elem()) {
+				// A message value, or a value the mask descends into, is copied to a new message.
 				v := reflect.New(dstFieldType.Elem())
-				v.Elem().Set(srcField)
+				if err := structToStruct(subFilter, srcField.Interface(), v.Interface(), fieldPath, o); err != nil {
+					return err
+				}
 				dstField.Set(v)
+				return nil
 			}
+			// Other struct values, e.g. time.Time, may have unexported state: they are assigned as a whole.
+			value, err := convertScalar(srcField, dstFieldType.Elem(), fieldPath, o)
+			if err != nil {
+				return err
+			}
+			v := reflect.New(dstFieldType.Elem())
+			v.Elem().Set(value)
+			dstField.Set(v)
 
-		case reflect.Array, reflect.Slice:
-			// Check if it is an array of values (non-pointers).
-			if dstFieldType.Elem().Kind() != reflect.Ptr {
-				// Handle this array/slice as a regular non-nested data structure: copy it entirely to dst.
-				dstField.Set(srcField)
-				continue
+		default:
+			value, err := convertScalar(srcField, dstFieldType.Elem(), fieldPath, o)
+			if err != nil {
+				return err
 			}
-			v := reflect.New(dstFieldType).Elem()
-			// Iterate over items of the slice/array.
+			v := reflect.New(dstFieldType.Elem())
+			v.Elem().Set(value)
+			dstField.Set(v)
+		}
+
+	case reflect.Array, reflect.Slice:
+		if err := sliceToStruct(subFilter, srcField, dstField, fieldPath, o); err != nil {
+			return err
+		}
+		o.normalizeEmptySlice(dstField)
+
+	case reflect.Map:
+		if srcField.Kind() == reflect.Map && excludesAll(subFilter) {
+			// All the entries are excluded.
+			dstField.Set(reflect.MakeMap(dstFieldType))
+			return nil
+		}
+		if srcField.Kind() == reflect.Map && indirectType(dstFieldType.Elem()).Kind() == reflect.Struct &&
+			indirectType(srcField.Type().Elem()).Kind() == reflect.Struct {
+			// Each message value of the map is copied using the same sub filter.
+			return mapToStruct(subFilter, srcField, dstField, fieldPath, o)
+		}
+		// Maps of scalars are copied entirely unless the sub filter selects specific keys.
+		if srcField.Kind() == reflect.Map {
+			srcField = filterMapKeys(subFilter, srcField)
+		}
+		value, err := convertScalar(srcField, dstFieldType, fieldPath, o)
+		if err != nil {
+			return err
+		}
+		dstField.Set(value)
+
+	default:
+		// For primitive data types just copy them entirely.
+		value, err := convertScalar(srcField, dstFieldType, fieldPath, o)
+		if err != nil {
+			return err
+		}
+		dstField.Set(value)
+	}
+	return nil
+}
+
+// sliceToStruct copies the slice or array `srcField` to the `dstField` slice or array.
+func sliceToStruct(subFilter FieldFilter, srcField, dstField reflect.Value, fieldPath string, o *options) error {
+	dstFieldType := dstField.Type()
+	// Check if it is an array of values (non-pointers).
+	if dstFieldType.Elem().Kind() != reflect.Ptr {
+		if dstFieldType.Kind() == reflect.Slice && dstFieldType.Elem().Kind() == reflect.Struct &&
+			(srcField.Kind() == reflect.Slice || srcField.Kind() == reflect.Array) &&
+			srcField.Type().Elem().Kind() == reflect.Struct && srcField.Type().Elem() != dstFieldType.Elem() {
+			// Slices of distinct struct types are copied item by item.
+			if srcField.Kind() == reflect.Slice && srcField.IsNil() {
+				dstField.Set(reflect.Zero(dstFieldType))
+				return nil
+			}
+			v := reflect.MakeSlice(dstFieldType, srcField.Len(), srcField.Len())
 			for i := 0; i < srcField.Len(); i++ {
-				subValue := srcField.Index(i)
-				newDst := reflect.New(dstFieldType.Elem().Elem())
-				if err := StructToStruct(subFilter, subValue.Interface(), newDst.Interface()); err != nil {
+				item := v.Index(i).Addr().Interface()
+				if err := structToStruct(subFilter, srcField.Index(i).Interface(), item, fieldPath, o); err != nil {
 					return err
 				}
-				v.Set(reflect.Append(v, newDst))
 			}
 			dstField.Set(v)
+			return nil
+		}
+		isSequence := srcField.Kind() == reflect.Slice || srcField.Kind() == reflect.Array
+		if isSequence && (srcField.Kind() != dstFieldType.Kind() || srcField.Type().Elem() != dstFieldType.Elem()) {
+			// A slice is copied to an array or vice versa, or the items need to be converted (e.g. repeated enums
+			// generated in different packages).
+			return copyItems(srcField, dstField, fieldPath, o)
+		}
+		// Handle this array/slice as a regular non-nested data structure: copy it entirely to dst.
+		if !srcField.Type().AssignableTo(dstFieldType) {
+			return typeMismatchError(fieldPath, srcField.Type(), dstFieldType)
+		}
+		dstField.Set(o.transformStrings(srcField))
+		return nil
+	}
+	if dstFieldType.Kind() == reflect.Array {
+		return messagesToArray(subFilter, srcField, dstField, fieldPath, o)
+	}
+	v := reflect.New(dstFieldType).Elem()
+	if dstFieldType.Kind() == reflect.Slice && (srcField.Kind() != reflect.Slice || !srcField.IsNil()) {
+		// A nil src slice results in a nil dst slice, an empty one in an empty dst slice.
+		v.Set(reflect.MakeSlice(dstFieldType, 0, srcField.Len()))
+	}
+	// Iterate over items of the slice/array.
+	for i := 0; i < srcField.Len(); i++ {
+		subValue := srcField.Index(i)
+		newDst := reflect.New(dstFieldType.Elem().Elem())
+		if o.sliceMerge != SliceReplace && i < dstField.Len() && !dstField.Index(i).IsNil() {
+			// Merge into the existing dst item.
+			newDst = dstField.Index(i)
+		} else if clone, ok := o.protoCloneOf(subFilter, subValue, dstFieldType.Elem()); ok {
+			v.Set(reflect.Append(v, clone))
+			continue
+		}
+		if err := structToStruct(subFilter, subValue.Interface(), newDst.Interface(), fieldPath, o); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, newDst))
+	}
+	if o.sliceMerge == SliceMergeKeep && dstField.Len() > srcField.Len() {
+		v.Set(reflect.AppendSlice(v, dstField.Slice(srcField.Len(), dstField.Len())))
+	}
+	dstField.Set(v)
+	return nil
+}
 
-		default:
-			// For primitive data types just copy them entirely.
-			dstField.Set(srcField)
+// messagesToArray copies the slice or array of messages `srcField` to the `dstField` array of pointers.
+// The src items that do not fit in the array are ignored unless WithErrorOnArrayOverflow is used.
+func messagesToArray(subFilter FieldFilter, srcField, dstField reflect.Value, fieldPath string, o *options) error {
+	if err := o.arrayOverflowError(srcField, dstField, fieldPath); err != nil {
+		return err
+	}
+	v := reflect.New(dstField.Type()).Elem()
+	for i := 0; i < srcField.Len() && i < v.Len(); i++ {
+		subValue := srcField.Index(i)
+		if subValue.Kind() == reflect.Ptr && subValue.IsNil() {
+			continue
+		}
+		newDst := reflect.New(v.Type().Elem().Elem())
+		if o.sliceMerge != SliceReplace && !dstField.Index(i).IsNil() {
+			// Merge into the existing dst item.
+			newDst = dstField.Index(i)
+		}
+		if err := structToStruct(subFilter, subValue.Interface(), newDst.Interface(), fieldPath, o); err != nil {
+			return err
+		}
+		v.Index(i).Set(newDst)
+	}
+	if o.sliceMerge == SliceMergeKeep {
+		for i := srcField.Len(); i < v.Len(); i++ {
+			v.Index(i).Set(dstField.Index(i))
+		}
+	}
+	dstField.Set(v)
+	return nil
+}
+
+// copyItems copies the items of the slice `srcField` to the array `dstField` or vice versa.
+func copyItems(srcField, dstField reflect.Value, fieldPath string, o *options) error {
+	dstFieldType := dstField.Type()
+	if dstFieldType.Kind() == reflect.Slice && srcField.Kind() == reflect.Slice && srcField.IsNil() {
+		dstField.Set(reflect.Zero(dstFieldType))
+		return nil
+	}
+
+	var v reflect.Value
+	if dstFieldType.Kind() == reflect.Array {
+		if err := o.arrayOverflowError(srcField, dstField, fieldPath); err != nil {
+			return err
+		}
+		v = reflect.New(dstFieldType).Elem()
+	} else {
+		v = reflect.MakeSlice(dstFieldType, srcField.Len(), srcField.Len())
+	}
+	for i := 0; i < srcField.Len() && i < v.Len(); i++ {
+		value, err := convertScalar(srcField.Index(i), dstFieldType.Elem(), fieldPath, o)
+		if err != nil {
+			return err
+		}
+		v.Index(i).Set(value)
+	}
+	dstField.Set(v)
+	return nil
+}
+
+// mapToStruct copies the map of messages `srcField` to the `dstField` map filtering every value with `subFilter`.
+func mapToStruct(subFilter FieldFilter, srcField, dstField reflect.Value, fieldPath string, o *options) error {
+	dstFieldType := dstField.Type()
+	if !srcField.Type().Key().AssignableTo(dstFieldType.Key()) {
+		return typeMismatchError(fieldPath, srcField.Type(), dstFieldType)
+	}
+	if srcField.IsNil() {
+		dstField.Set(reflect.Zero(dstFieldType))
+		return nil
+	}
+
+	dstElemType := dstFieldType.Elem()
+	v := reflect.MakeMapWithSize(dstFieldType, srcField.Len())
+	for _, key := range srcField.MapKeys() {
+		srcValue := srcField.MapIndex(key)
+		if srcValue.Kind() == reflect.Ptr && srcValue.IsNil() {
+			v.SetMapIndex(key, reflect.Zero(dstElemType))
+			continue
+		}
+		newDst := reflect.New(indirectType(dstElemType))
+		if err := structToStruct(subFilter, srcValue.Interface(), newDst.Interface(), fieldPath, o); err != nil {
+			return err
+		}
+		if dstElemType.Kind() != reflect.Ptr {
+			newDst = newDst.Elem()
+		}
+		v.SetMapIndex(key, newDst)
+	}
+	dstField.Set(v)
+	return nil
+}
+
+// opaqueToStruct copies the value of an opaque type (see WithOpaqueTypes) to `dstField` without descending into it.
+// Pointers are copied to new pointers to a shallow copy of the value.
+func opaqueToStruct(srcField, dstField reflect.Value, fieldPath string) error {
+	if !srcField.Type().AssignableTo(dstField.Type()) {
+		return typeMismatchError(fieldPath, srcField.Type(), dstField.Type())
+	}
+	if srcField.Kind() == reflect.Ptr && !srcField.IsNil() {
+		v := reflect.New(srcField.Type().Elem())
+		v.Elem().Set(srcField.Elem())
+		dstField.Set(v)
+		return nil
+	}
+	dstField.Set(srcField)
+	return nil
+}
+
+// fieldMaskTypes are the google.protobuf.FieldMask types: a FieldMask field is data, so it is copied as a leaf.
+var fieldMaskTypes = map[reflect.Type]bool{
+	reflect.TypeOf(field_mask.FieldMask{}): true,
+	reflect.TypeOf(types.FieldMask{}):      true,
+}
+
+// isFieldMaskType reports whether `t` is a google.protobuf.FieldMask or a pointer to it.
+func isFieldMaskType(t reflect.Type) bool {
+	return fieldMaskTypes[indirectType(t)]
+}
+
+// customType is the interface of the gogoproto.customtype types.
+type customType interface {
+	Marshal() ([]byte, error)
+	MarshalTo(data []byte) (n int, err error)
+	Unmarshal(data []byte) error
+	Size() int
+}
+
+var customTypeType = reflect.TypeOf((*customType)(nil)).Elem()
+
+// isCustomType reports whether `t` is a gogoproto.customtype type: it is marshaled like a message, but it is not
+// a message.
+func isCustomType(t reflect.Type) bool {
+	t = indirectType(t)
+	if t.Kind() == reflect.Interface {
+		return false
+	}
+	ptr := reflect.PtrTo(t)
+	_, isMessage := ptr.MethodByName("ProtoMessage")
+	return ptr.Implements(customTypeType) && !isMessage
+}
+
+// isMessageType reports whether `t` or a pointer to it is a generated proto message type.
+func isMessageType(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	_, ok := t.MethodByName("ProtoMessage")
+	return ok
+}
+
+// mapEntriesToMap copies the slice of key/value entry messages `srcField` to the `dstField` map.
+func mapEntriesToMap(srcField, dstField reflect.Value, fieldPath string, o *options) error {
+	if srcField.Kind() != reflect.Slice && srcField.Kind() != reflect.Array {
+		return errors.Errorf("field %s of type %s is not a slice of map entries", fieldPath, srcField.Type())
+	}
+	if srcField.Kind() == reflect.Slice && srcField.IsNil() {
+		dstField.Set(reflect.Zero(dstField.Type()))
+		return nil
+	}
+
+	dstFieldType := dstField.Type()
+	v := reflect.MakeMapWithSize(dstFieldType, srcField.Len())
+	for i := 0; i < srcField.Len(); i++ {
+		entry := indirect(srcField.Index(i))
+		if !entry.IsValid() {
+			// Nil entries are skipped.
+			continue
 		}
+		if entry.Kind() != reflect.Struct {
+			return errors.Errorf("field %s of type %s is not a slice of map entries", fieldPath, srcField.Type())
+		}
+		entryKey, entryValue := entry.FieldByName("Key"), entry.FieldByName("Value")
+		if !entryKey.IsValid() || !entryValue.IsValid() {
+			return errors.Errorf("map entry %s of field %s must have Key and Value fields", entry.Type(), fieldPath)
+		}
+		key, err := convertScalar(entryKey, dstFieldType.Key(), fieldPath, o)
+		if err != nil {
+			return err
+		}
+		value, err := convertScalar(entryValue, dstFieldType.Elem(), fieldPath, o)
+		if err != nil {
+			return err
+		}
+		v.SetMapIndex(key, value)
+	}
+	dstField.Set(v)
+	return nil
+}
+
+// convertScalar converts the scalar `srcValue` to `dstType`. Values of distinct named types that share the same
+// underlying kind (e.g. the same enum generated in different packages) are converted unless WithStrictTypes is used.
+func convertScalar(srcValue reflect.Value, dstType reflect.Type, fieldPath string, o *options) (reflect.Value, error) {
+	srcValue = o.transformStrings(srcValue)
+	if !srcValue.Type().AssignableTo(dstType) {
+		if o.strictTypes || srcValue.Kind() != dstType.Kind() || !srcValue.Type().ConvertibleTo(dstType) {
+			return reflect.Value{}, typeMismatchError(fieldPath, srcValue.Type(), dstType)
+		}
+		srcValue = srcValue.Convert(dstType)
+	}
+	if isValid, ok := o.enumValidators[dstType]; ok && !isValid(srcValue) {
+		return reflect.Value{}, errors.Errorf("field %s: %v is not a valid %s value", fieldPath, srcValue.Interface(),
+			dstType)
+	}
+	return srcValue, nil
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// fieldToRawJSON sets the JSON encoding of the filtered `srcField` on the json.RawMessage `dstField`.
+func fieldToRawJSON(subFilter FieldFilter, srcField, dstField reflect.Value, fieldPath string, o *options) error {
+	var v interface{}
+	switch {
+	case (srcField.Kind() == reflect.Ptr || srcField.Kind() == reflect.Interface) && srcField.IsNil():
+		dstField.Set(reflect.Zero(dstField.Type()))
+		return nil
+
+	case indirect(srcField).Kind() == reflect.Struct:
+		m := make(map[string]interface{})
+		if err := structToMap(subFilter, srcField.Interface(), m, fieldPath, o); err != nil {
+			return err
+		}
+		v = m
+
+	case (srcField.Kind() == reflect.Slice || srcField.Kind() == reflect.Array) &&
+		indirectType(srcField.Type().Elem()).Kind() == reflect.Struct:
+		// The items are filtered the same way StructToMap filters the repeated messages.
+		if srcField.Kind() == reflect.Slice && srcField.IsNil() {
+			break
+		}
+		items := make([]interface{}, srcField.Len())
+		for i := range items {
+			item := srcField.Index(i)
+			if item.Kind() == reflect.Ptr && item.IsNil() {
+				continue
+			}
+			m := make(map[string]interface{})
+			if err := structToMap(subFilter, item.Interface(), m, fieldPath, o); err != nil {
+				return err
+			}
+			items[i] = m
+		}
+		v = items
+
+	case srcField.Kind() == reflect.Map:
+		m, err := mapFieldToMap(subFilter, srcField, fieldPath, o)
+		if err != nil {
+			return err
+		}
+		v = m
+
+	default:
+		v = srcField.Interface()
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal the field %s to JSON", fieldPath)
 	}
+	dstField.SetBytes(data)
 	return nil
 }
 
-func getFieldMappingFromTags(val reflect.Value, reverse bool) map[string]string {
+func typeMismatchError(fieldPath string, srcType, dstType reflect.Type) error {
+	return errors.Errorf("field %s of type %s can not be copied to type %s", fieldPath, srcType, dstType)
+}
+
+// defaultTagNames are the struct tags getFieldMappingFromTags consults by default, in priority order.
+var defaultTagNames = []string{"protobuf", "protobuf_oneof", "json", "mapstructure", "bson"}
+
+func getFieldMappingFromTags(val reflect.Value, reverse bool, tagNames []string) map[string]string {
 	fields := map[string]string{}
 
 	for i := 0; i < val.NumField(); i++ {
 		field := val.Type().Field(i)
-		tag := field.Tag
+		if field.PkgPath != "" {
+			// Unexported fields can not be copied: these are typically generator internals
+			// such as `state`, `sizeCache` and `unknownFields` in APIv2 protobuf messages.
+			continue
+		}
+
+		name, ok := fieldNameFromTags(field, tagNames)
+		if !ok {
+			continue
+		}
+
+		from, to := field.Name, name
+		if reverse {
+			from, to = to, from
+		}
+
+		fields[from] = to
+	}
 
-		var spec string
+	return fields
+}
+
+// fieldNameFromTags returns the name of the `field` defined by the first of `tagNames` present on it.
+// It returns false for the fields that are excluded by their tags, e.g. `json:"-"`.
+func fieldNameFromTags(field reflect.StructField, tagNames []string) (string, bool) {
+	spec := "name=" + field.Name
+	for _, tagName := range tagNames {
+		value := field.Tag.Get(tagName)
+		if value == "" {
+			continue
+		}
+		if tagName == "protobuf" {
+			spec = value
+		} else {
+			// The name is the first element of the tag value, e.g. `json:"name,omitempty"`.
+			spec = "name=" + value
+		}
+		break
+	}
 
+	var (
+		name  string
+		found bool
+	)
+	for _, opt := range strings.Split(spec, ",") {
+		kv := strings.SplitN(opt, "=", 2)
 		switch {
-		case tag.Get("protobuf") != "":
-			spec = tag.Get("protobuf")
+		case len(kv) != 2:
+			continue
+		case kv[0] != "name":
+			continue
+		case kv[1] == "-", kv[1] == "":
+			continue
+		}
+		name, found = kv[1], true
+	}
+	if strings.HasPrefix(spec, "group,") {
+		// The proto2 groups are named after their types, e.g. `protobuf:"group,1,opt,name=Result"`, while the name
+		// of the field is the lowercase type name.
+		if !found {
+			name, found = field.Name, true
+		}
+		name = strings.ToLower(name)
+	}
+	return name, found
+}
 
-		case tag.Get("protobuf_oneof") != "":
-			spec = "name=" + tag.Get("protobuf_oneof")
+// fieldMapping is the same as getFieldMappingFromTags, but also applies WithProtoJSONNames and WithSrcNaming.
+func (o *options) fieldMapping(val reflect.Value, reverse bool) map[string]string {
+	return renameFields(o.tagFieldMapping(val, reverse), reverse, o.srcNaming)
+}
 
-		case tag.Get("json") != "":
-			spec = "name=" + tag.Get("json")
+// dstFieldMapping is the reverse fieldMapping of the dst structs: it applies WithDstNaming instead of WithSrcNaming.
+func (o *options) dstFieldMapping(val reflect.Value) map[string]string {
+	return renameFields(o.tagFieldMapping(val, true), true, o.dstNaming)
+}
 
-		default:
-			spec = "name=" + field.Name
+// renameFields applies `naming` to the field names of the `fields` mapping built by getFieldMappingFromTags.
+func renameFields(fields map[string]string, reverse bool, naming Naming) map[string]string {
+	if naming == nil {
+		return fields
+	}
+	renamed := make(map[string]string, len(fields))
+	for from, to := range fields {
+		if reverse {
+			renamed[naming(from)] = to
+		} else {
+			renamed[from] = naming(to)
 		}
+	}
+	return renamed
+}
 
-		opts := strings.Split(spec, ",")
-		for _, opt := range opts {
-			kv := strings.SplitN(opt, "=", 2)
-			switch {
-			case len(kv) != 2:
-				continue
-			case kv[0] != "name":
-				continue
-			case kv[1] == "-", kv[1] == "":
+// tagFieldMapping is the same as getFieldMappingFromTags, but also applies WithGetters and WithProtoJSONNames.
+func (o *options) tagFieldMapping(val reflect.Value, reverse bool) map[string]string {
+	fields := getFieldMappingFromTags(val, reverse, o.tagNames)
+	if o.getters && !reverse {
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			if field.PkgPath == "" || !hasGetter(val.Type(), field.Name) {
 				continue
 			}
+			if name, ok := fieldNameFromTags(field, o.tagNames); ok {
+				fields[field.Name] = name
+			}
+		}
+	}
+	if !o.protoJSONNames {
+		return fields
+	}
 
-			from, to := val.Type().Field(i).Name, kv[1]
-			if reverse {
-				from, to = to, from
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		jsonName := protobufJSONName(field)
+		if jsonName == "" {
+			continue
+		}
+		if !reverse {
+			if _, ok := fields[field.Name]; ok {
+				fields[field.Name] = jsonName
 			}
+			continue
+		}
+		if _, ok := fields[jsonName]; !ok {
+			fields[jsonName] = field.Name
+		}
+	}
+	return fields
+}
 
-			fields[from] = to
+// srcField returns the value of the field `fieldName` of `src`, read through its getter if WithGetters is used.
+func (o *options) srcField(src interface{}, fieldName string) (reflect.Value, error) {
+	if o.getters {
+		srcVal := reflect.ValueOf(src)
+		if srcVal.Kind() != reflect.Ptr {
+			// Make the methods with pointer receivers available.
+			ptr := reflect.New(srcVal.Type())
+			ptr.Elem().Set(srcVal)
+			srcVal = ptr
+		}
+		if hasGetter(srcVal.Type().Elem(), fieldName) {
+			return srcVal.MethodByName(getterName(fieldName)).Call(nil)[0], nil
 		}
 	}
+	return getField(src, fieldName)
+}
 
-	return fields
+// hasGetter reports whether the struct type `t` has a getter method for the field `fieldName`.
+func hasGetter(t reflect.Type, fieldName string) bool {
+	method, ok := reflect.PtrTo(t).MethodByName(getterName(fieldName))
+	// The receiver is the first argument.
+	return ok && method.Type.NumIn() == 1 && method.Type.NumOut() == 1
+}
+
+// getterName returns the name of the getter method of the field `fieldName`, e.g. GetUsername for username.
+func getterName(fieldName string) string {
+	return "Get" + strings.ToUpper(fieldName[:1]) + fieldName[1:]
+}
+
+// protobufJSONName returns the JSON name from a `protobuf:"bytes,1,opt,name=original_url,json=originalUrl"` tag.
+// An empty string is returned if the JSON name is the same as the field name.
+func protobufJSONName(field reflect.StructField) string {
+	for _, opt := range strings.Split(field.Tag.Get("protobuf"), ",") {
+		if strings.HasPrefix(opt, "json=") {
+			return strings.TrimPrefix(opt, "json=")
+		}
+	}
+	return ""
 }
 
 // StructToMap copies `src` struct to the `dst` map.
@@ -180,10 +1111,40 @@ func StructToMap(
 	filter FieldFilter,
 	src interface{},
 	dst map[string]interface{},
+	opts ...interface{},
+) error {
+	o := newOptions(opts)
+	if isNil(src) {
+		return o.nilSrcError()
+	}
+	filter = o.rootFilter(filter)
+	if err := cycleError(filter); err != nil {
+		return err
+	}
+	if err := structToMap(filter, src, dst, "", o); err != nil {
+		return err
+	}
+	if o.noAlias {
+		if err := aliasError(src, dst, o); err != nil {
+			return err
+		}
+	}
+	return o.coverageError()
+}
+
+func structToMap(
+	filter FieldFilter,
+	src interface{},
+	dst map[string]interface{},
+	path string,
+	o *options,
 ) error {
 	srcVal := indirect(reflect.ValueOf(src))
 
-	fields := getFieldMappingFromTags(srcVal, false)
+	fields := o.fieldMapping(srcVal, false)
+	if o.logger != nil && path != "" {
+		o.logger("entering %s", path)
+	}
 
 	for i := 0; i < srcVal.NumField(); i++ {
 		fieldName := srcVal.Type().Field(i).Name
@@ -193,25 +1154,95 @@ func StructToMap(
 		}
 
 		subFilter, ok := filter.Filter(fields[fieldName])
+		if ok && o.stopPaths != nil && o.stopPaths[joinPath(path, fields[fieldName])] {
+			continue
+		}
 		if !ok {
 			// Skip this field.
+			if o.logger != nil || o.requireFullCoverage {
+				o.skip(joinPath(path, fields[fieldName]))
+			}
 			continue
 		}
-		srcField, err := getField(src, fieldName)
+
+		fieldPath := joinPath(path, fields[fieldName])
+		if o.logger != nil {
+			o.logger("copying %s", fieldPath)
+		}
+		if isUnsupportedKind(srcVal.Type().Field(i).Type.Kind()) {
+			if o.errorOnUnsupported {
+				return errors.Errorf("field %s of kind %s can not be copied", fieldPath,
+					srcVal.Type().Field(i).Type.Kind())
+			}
+			continue
+		}
+
+		srcField, err := o.srcField(src, fieldName)
 		if err != nil {
 			return errors.Wrap(err, fmt.Sprintf("failed to get the field %s from %T", fieldName, src))
 		}
+		if srcField, err = o.applyDefault(srcField, fieldPath); err != nil {
+			return err
+		}
+		if o.absent(srcVal.Type().Field(i), srcField) {
+			continue
+		}
 
 		fieldName = fields[fieldName]
+		if renamed, ok := o.keyRenames[fieldPath]; ok {
+			fieldName = renamed
+		}
+
+		if format, ok := o.formatter(srcField.Type()); ok {
+			dst[fieldName] = format(srcField)
+			continue
+		}
+
+		if o.flattenOneof && srcField.Kind() == reflect.Interface {
+			if _, ok := srcVal.Type().Field(i).Tag.Lookup("protobuf_oneof"); ok {
+				// Put the fields of the oneof wrapper to the parent map, same as protobuf JSON does.
+				if srcField.IsNil() {
+					continue
+				}
+				if err := structToMap(subFilter, srcField.Interface(), dst, fieldPath, o); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if o.nativeStructValues {
+			if v, ok := structValueToNative(subFilter, srcField.Interface()); ok {
+				dst[fieldName] = v
+				continue
+			}
+		}
+
+		if o.isOpaque(srcField.Type()) {
+			dst[fieldName] = srcField.Interface()
+			continue
+		}
 
 		switch srcField.Kind() {
 		case reflect.Ptr, reflect.Interface:
 			if srcField.IsNil() {
-				dst[fieldName] = nil
+				isMessage := srcField.Kind() == reflect.Ptr && srcField.Type().Elem().Kind() == reflect.Struct
+				if o.nilShape && isMessage && isDeepMask(subFilter) {
+					dst[fieldName] = nilMessageShape(subFilter, srcField.Type().Elem(), fieldPath, o)
+				} else if o.nilAsEmptyMap && isMessage {
+					dst[fieldName] = map[string]interface{}{}
+				} else {
+					dst[fieldName] = nil
+				}
+				continue
+			}
+			if elem := indirect(srcField.Elem()); elem.Kind() != reflect.Struct {
+				// A pointer to a scalar (e.g. a proto2 optional field) or a scalar in an interface.
+				dst[fieldName] = o.mapValue(elem)
 				continue
 			}
 			v := make(map[string]interface{})
-			if err := StructToMap(subFilter, srcField.Interface(), v); err != nil {
+			if err := structToMap(subFilter, srcField.Interface(), v, fieldPath, o); err != nil {
 				return err
 			}
 			dst[fieldName] = v
@@ -220,8 +1251,14 @@ func StructToMap(
 			// Check if it is an array of values (non-pointers).
 			if srcField.Type().Elem().Kind() != reflect.Ptr {
 				// Handle this array/slice as a regular non-nested data structure: copy it entirely to dst.
-				if srcField.Len() > 0 {
-					dst[fieldName] = srcField.Interface()
+				if format, ok := o.formatter(srcField.Type().Elem()); ok && srcField.Len() > 0 {
+					v := make([]interface{}, srcField.Len())
+					for i := range v {
+						v[i] = format(srcField.Index(i))
+					}
+					dst[fieldName] = v
+				} else if srcField.Len() > 0 {
+					dst[fieldName] = o.mapValue(srcField)
 				} else {
 					dst[fieldName] = []interface{}(nil)
 				}
@@ -231,22 +1268,193 @@ func StructToMap(
 			// Iterate over items of the slice/array.
 			for i := 0; i < srcField.Len(); i++ {
 				subValue := srcField.Index(i)
+				if subValue.Kind() == reflect.Ptr && subValue.IsNil() {
+					// A nil message is kept as a nil map, which is marshaled to null.
+					v = append(v, nil)
+					continue
+				}
 				newDst := make(map[string]interface{})
-				if err := StructToMap(subFilter, subValue.Interface(), newDst); err != nil {
+				if err := structToMap(subFilter, subValue.Interface(), newDst, fieldPath, o); err != nil {
 					return err
 				}
 				v = append(v, newDst)
 			}
 			dst[fieldName] = v
 
+		case reflect.Map:
+			v, err := mapFieldToMap(subFilter, srcField, fieldPath, o)
+			if err != nil {
+				return err
+			}
+			dst[fieldName] = v
+
 		default:
 			// Set a value on a map.
-			dst[fieldName] = srcField.Interface()
+			dst[fieldName] = o.mapValue(srcField)
 		}
 	}
 	return nil
 }
 
+// nilMessageShape returns the map StructToMap emits for a nil message of type `t` in the WithNilShape mode:
+// the fields selected by `filter` are set to nil, the messages selected by a nested mask are represented the same way.
+func nilMessageShape(filter FieldFilter, t reflect.Type, path string, o *options) map[string]interface{} {
+	mapping := o.fieldMapping(reflect.New(t).Elem(), false)
+	shape := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldName, ok := mapping[field.Name]
+		if !ok {
+			continue
+		}
+		subFilter, ok := filter.Filter(fieldName)
+		if !ok {
+			continue
+		}
+		fieldPath := joinPath(path, fieldName)
+		if o.stopPaths != nil && o.stopPaths[fieldPath] {
+			continue
+		}
+		if renamed, ok := o.keyRenames[fieldPath]; ok {
+			fieldName = renamed
+		}
+		if isDeepMask(subFilter) && field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
+			shape[fieldName] = nilMessageShape(subFilter, field.Type.Elem(), fieldPath, o)
+		} else {
+			shape[fieldName] = nil
+		}
+	}
+	return shape
+}
+
+// isDeepMask reports whether `filter` is a Mask that selects specific sub fields.
+func isDeepMask(filter FieldFilter) bool {
+	mask, ok := filter.(Mask)
+	return ok && len(mask) > 0
+}
+
+// typeName returns a short name of the type `t` to be used in errors. Anonymous structs, which would otherwise be
+// printed with all their fields and tags, are named "struct { ... }".
+func typeName(t reflect.Type) string {
+	switch {
+	case t == nil:
+		return "nil"
+	case t.Kind() == reflect.Ptr:
+		return "*" + typeName(t.Elem())
+	case t.Kind() == reflect.Struct && t.Name() == "":
+		return "struct { ... }"
+	default:
+		return t.String()
+	}
+}
+
+// KeyValue is a map entry emitted by StructToMap in place of the maps when WithSortedMapEntries is used.
+type KeyValue struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// mapFieldToMap returns the StructToMap representation of the map field `srcField`: the message values are filtered
+// with `subFilter`, the maps of scalars are used as is unless WithSortedMapEntries is used.
+func mapFieldToMap(subFilter FieldFilter, srcField reflect.Value, fieldPath string, o *options) (interface{}, error) {
+	isMessageMap := indirectType(srcField.Type().Elem()).Kind() == reflect.Struct
+	if !isMessageMap && !o.sortedMapEntries {
+		// Maps of scalars are copied entirely unless the sub filter selects specific keys.
+		return filterMapKeys(subFilter, srcField).Interface(), nil
+	}
+	if srcField.IsNil() {
+		return nil, nil
+	}
+
+	mapKeys := srcField.MapKeys()
+	if excludesAll(subFilter) {
+		mapKeys = nil
+	}
+	keys := make([]string, 0, len(mapKeys))
+	v := make(map[string]interface{}, len(mapKeys))
+	for _, key := range mapKeys {
+		keyString := mapKeyString(key)
+		if !isMessageMap && !selectsAll(subFilter) {
+			if _, ok := subFilter.Filter(keyString); !ok {
+				continue
+			}
+		}
+		keys = append(keys, keyString)
+		subValue := srcField.MapIndex(key)
+		switch {
+		case !isMessageMap:
+			v[keyString] = subValue.Interface()
+
+		case subValue.Kind() == reflect.Ptr && subValue.IsNil():
+			v[keyString] = nil
+
+		default:
+			// Filter every message value of the map with the same sub filter.
+			newDst := make(map[string]interface{})
+			if err := structToMap(subFilter, subValue.Interface(), newDst, fieldPath, o); err != nil {
+				return nil, err
+			}
+			v[keyString] = newDst
+		}
+	}
+	if !o.sortedMapEntries {
+		return v, nil
+	}
+
+	sort.Strings(keys)
+	entries := make([]KeyValue, len(keys))
+	for i, key := range keys {
+		entries[i] = KeyValue{Key: key, Value: v[key]}
+	}
+	return entries, nil
+}
+
+// filterMapKeys returns a copy of the map of scalars `m` with only the keys selected by `filter`, e.g. "foo" for
+// the mask "meta{foo}". `m` itself is returned if the filter selects all the keys.
+func filterMapKeys(filter FieldFilter, m reflect.Value) reflect.Value {
+	if selectsAll(filter) || m.IsNil() {
+		return m
+	}
+	result := reflect.MakeMapWithSize(m.Type(), m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		if _, ok := filter.Filter(mapKeyString(iter.Key())); ok {
+			result.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	return result
+}
+
+// selectsAll reports whether `filter` is an empty Mask or MaskInverse, which selects all the fields.
+func selectsAll(filter FieldFilter) bool {
+	switch filter := filter.(type) {
+	case nil:
+		return true
+	case Mask:
+		return len(filter) == 0
+	case MaskInverse:
+		return len(filter) == 0
+	}
+	return false
+}
+
+// mapKeyString returns the string representation of a map key, e.g. "1" for the keys of a map<int32, Message>.
+func mapKeyString(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return key.String()
+	}
+	return fmt.Sprint(key.Interface())
+}
+
+// isUnsupportedKind reports whether the values of the given kind can not be meaningfully copied.
+func isUnsupportedKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
 func getField(obj interface{}, name string) (reflect.Value, error) {
 	objValue := reflectValue(obj)
 	field := objValue.FieldByName(name)
@@ -268,6 +1476,25 @@ func reflectValue(obj interface{}) reflect.Value {
 	return val
 }
 
+// dynamicDst returns the value held by `dst` if it is a pointer to a non-nil interface, so that the copying targets
+// the concrete type rather than the interface.
+func dynamicDst(dst interface{}) interface{} {
+	v := reflect.ValueOf(dst)
+	for v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Interface && !v.Elem().IsNil() {
+		v = v.Elem().Elem()
+	}
+	if !v.IsValid() {
+		return dst
+	}
+	return v.Interface()
+}
+
+// isNil reports whether `obj` is nil or a nil pointer.
+func isNil(obj interface{}) bool {
+	v := reflect.ValueOf(obj)
+	return !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil()
+}
+
 func indirect(v reflect.Value) reflect.Value {
 	for v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -0,0 +1,48 @@
+//go:build go1.18
+// +build go1.18
+
+package fieldmask_utils
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// CopyStruct allocates a new `D` and copies `src` to it using StructToStruct.
+// It is a typed shortcut for the common case when the dst struct does not exist yet.
+func CopyStruct[S, D any](filter FieldFilter, src *S, opts ...interface{}) (*D, error) {
+	dst := new(D)
+	if err := StructToStruct(filter, src, dst, opts...); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// StructToTypedMap is like StructToMap, but returns a map of `V` values, e.g. a map[string]string of the selected
+// string fields. It fails if any of the selected fields is not of type `V` (the messages are mapped to
+// map[string]interface{} values). The nil values, such as the nil messages, result in zero `V` values.
+func StructToTypedMap[V any](filter FieldFilter, src interface{}, opts ...interface{}) (map[string]V, error) {
+	m := make(map[string]interface{})
+	if err := StructToMap(filter, src, m, opts...); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]V, len(m))
+	for _, key := range keys {
+		value, ok := m[key].(V)
+		if !ok && m[key] != nil {
+			return nil, errors.Errorf("field %s of type %T is not assignable to %s", key, m[key],
+				reflect.TypeOf((*V)(nil)).Elem())
+		}
+		result[key] = value
+	}
+	return result, nil
+}
@@ -0,0 +1,52 @@
+//go:build go1.18
+// +build go1.18
+
+package fieldmask_utils_test
+
+import (
+	"testing"
+
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyStruct(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,username,avatar{original_url}")
+	userDst, err := fieldmask_utils.CopyStruct[testproto.User, testproto.User](mask, testUserFull)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:       testUserFull.Id,
+		Username: testUserFull.Username,
+		Avatar:   &testproto.Image{OriginalUrl: testUserFull.Avatar.OriginalUrl},
+	}, userDst)
+}
+
+func TestCopyStructFail(t *testing.T) {
+	type User struct {
+		Id uint32 `json:"id"`
+	}
+	mask := fieldmask_utils.MaskFromString("username")
+	userDst, err := fieldmask_utils.CopyStruct[testproto.User, User](mask, testUserFull)
+	assert.Error(t, err)
+	assert.Nil(t, userDst)
+}
+
+func TestStructToTypedMap(t *testing.T) {
+	m, err := fieldmask_utils.StructToTypedMap[string](fieldmask_utils.MaskFromString("username"), testUserFull)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": testUserFull.Username}, m)
+
+	// The messages are not strings.
+	_, err = fieldmask_utils.StructToTypedMap[string](
+		fieldmask_utils.MaskFromString("username,avatar{original_url}"), testUserFull)
+	assert.Error(t, err)
+
+	images, err := fieldmask_utils.StructToTypedMap[map[string]interface{}](
+		fieldmask_utils.MaskFromString("avatar{original_url}"), testUserFull)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]interface{}{
+		"avatar": {"original_url": testUserFull.Avatar.OriginalUrl},
+	}, images)
+}
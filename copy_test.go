@@ -1,17 +1,25 @@
 package fieldmask_utils_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/golang/protobuf/ptypes/timestamp"
 	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
 	"github.com/propertechnologies/fieldmask-utils/testproto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/protobuf/field_mask"
 )
 
 var testUserFull *testproto.User
@@ -331,3 +339,2360 @@ func TestStructToMapEnforceWhitelist(t *testing.T) {
 	)
 	assert.Error(t, err)
 }
+
+func TestStructToStructWithDstName(t *testing.T) {
+	type ApiImage struct {
+		ApiUrl string
+	}
+	type Image struct {
+		Url string
+	}
+	type ApiUser struct {
+		ApiId     uint32
+		ApiAvatar *ApiImage
+	}
+	type User struct {
+		Id     uint32
+		Avatar *Image
+	}
+
+	src := &ApiUser{ApiId: 1, ApiAvatar: &ApiImage{ApiUrl: "avatar.jpg"}}
+	dst := &User{}
+	var paths []string
+	stripPrefix := func(srcPath string) string {
+		paths = append(paths, srcPath)
+		segments := strings.Split(srcPath, ".")
+		return strings.TrimPrefix(segments[len(segments)-1], "Api")
+	}
+
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString(""), src, dst,
+		fieldmask_utils.WithDstName(stripPrefix))
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 1, Avatar: &Image{Url: "avatar.jpg"}}, dst)
+	assert.Equal(t, []string{"ApiId", "ApiAvatar", "ApiAvatar.ApiUrl"}, paths)
+}
+
+func BenchmarkStructToStructEmptyMask(b *testing.B) {
+	mask := fieldmask_utils.MaskFromString("")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := fieldmask_utils.StructToStruct(mask, testUserFull, &testproto.User{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStructToStructPartialMask(b *testing.B) {
+	mask := fieldmask_utils.MaskFromString(
+		"id,avatar{original_url},tags,images,permissions,friends{images{resized_url}},name{male_name}")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := fieldmask_utils.StructToStruct(mask, testUserFull, &testproto.User{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStructToStructMaskInverse(b *testing.B) {
+	mask := fieldmask_utils.MaskInverse{"id": nil, "friends": fieldmask_utils.MaskInverse{"username": nil}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := fieldmask_utils.StructToStruct(mask, testUserFull, &testproto.User{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStructToStructFullSubtrees(b *testing.B) {
+	mask := fieldmask_utils.MaskFromString("avatar,images,friends")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := fieldmask_utils.StructToStruct(mask, testUserFull, &testproto.User{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStructToStructFullSubtreesWithProtoClone(b *testing.B) {
+	mask := fieldmask_utils.MaskFromString("avatar,images,friends")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := fieldmask_utils.StructToStruct(mask, testUserFull, &testproto.User{},
+			fieldmask_utils.WithProtoCloneForFullSubtrees())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type userWithCallback struct {
+	Id       uint32
+	Callback func()
+	Events   chan string
+}
+
+func TestStructToStructSkipsUnsupportedKinds(t *testing.T) {
+	src := &userWithCallback{Id: 1, Callback: func() {}, Events: make(chan string)}
+	dst := &userWithCallback{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString(""), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, src.Id, dst.Id)
+	assert.Nil(t, dst.Callback)
+	assert.Nil(t, dst.Events)
+
+	// dst does not need to have the skipped fields at all.
+	type User struct {
+		Id uint32
+	}
+	userDst := &User{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString(""), src, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, src.Id, userDst.Id)
+}
+
+func TestStructToStructErrorOnUnsupportedKinds(t *testing.T) {
+	src := &userWithCallback{Id: 1, Callback: func() {}}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString(""), src, &userWithCallback{},
+		fieldmask_utils.WithErrorOnUnsupported())
+	assert.Error(t, err)
+
+	// Unsupported fields that are not selected by the mask are fine.
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("Id"), src, &userWithCallback{},
+		fieldmask_utils.WithErrorOnUnsupported())
+	assert.NoError(t, err)
+}
+
+func TestStructToMapSkipsUnsupportedKinds(t *testing.T) {
+	src := &userWithCallback{Id: 1, Callback: func() {}, Events: make(chan string)}
+	dst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString(""), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Id": src.Id}, dst)
+
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString(""), src, make(map[string]interface{}),
+		fieldmask_utils.WithErrorOnUnsupported())
+	assert.Error(t, err)
+}
+
+type isValueUserName interface {
+	isValueUserName()
+}
+
+type ValueUserFullName struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+func (ValueUserFullName) isValueUserName() {}
+
+type ValueUserNickname string
+
+func (ValueUserNickname) isValueUserName() {}
+
+type ValueUser struct {
+	Id   uint32          `json:"id"`
+	Name isValueUserName `json:"name"`
+}
+
+func TestStructToStructValueTypeOneofWrapper(t *testing.T) {
+	src := &ValueUser{Id: 1, Name: ValueUserFullName{FirstName: "John", LastName: "Smith"}}
+	dst := &ValueUser{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("name{first_name}"), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &ValueUser{Name: ValueUserFullName{FirstName: "John"}}, dst)
+
+	src = &ValueUser{Id: 1, Name: ValueUserNickname("johnny")}
+	dst = &ValueUser{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("name"), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &ValueUser{Name: ValueUserNickname("johnny")}, dst)
+}
+
+func TestStructToStructWithDefaultMask(t *testing.T) {
+	defaultMask := fieldmask_utils.MaskFromString("id,username")
+
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString(""), testUserFull, userDst,
+		fieldmask_utils.WithDefaultMask(defaultMask))
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{Id: testUserFull.Id, Username: testUserFull.Username}, userDst)
+
+	// The default mask is not used when the mask is not empty.
+	userDst = &testproto.User{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("role"), testUserFull, userDst,
+		fieldmask_utils.WithDefaultMask(defaultMask))
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{Role: testUserFull.Role}, userDst)
+}
+
+func TestStructToMapWithDefaultMask(t *testing.T) {
+	userDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, testUserFull, userDst,
+		fieldmask_utils.WithDefaultMask(fieldmask_utils.MaskFromString("id,username")))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": testUserFull.Id, "username": testUserFull.Username}, userDst)
+}
+
+// apiV2Image mimics the shape of a message generated by protoc-gen-go APIv2 (or vtprotobuf).
+type apiV2Image struct {
+	state         struct{ atomicMessageInfo *int }
+	sizeCache     int32
+	unknownFields []byte
+
+	OriginalUrl string `protobuf:"bytes,1,opt,name=original_url,json=originalUrl,proto3" json:"original_url,omitempty"`
+	ResizedUrl  string `protobuf:"bytes,2,opt,name=resized_url,json=resizedUrl,proto3" json:"resized_url,omitempty"`
+}
+
+func TestStructToStructAPIv2InternalFieldsIgnored(t *testing.T) {
+	src := &apiV2Image{sizeCache: 10, unknownFields: []byte("foo"), OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"}
+	dst := &apiV2Image{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString(""), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &apiV2Image{OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"}, dst)
+
+	imageDst := &testproto.Image{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("original_url"), src, imageDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.Image{OriginalUrl: "original.jpg"}, imageDst)
+}
+
+func TestStructToMapAPIv2InternalFieldsIgnored(t *testing.T) {
+	src := &apiV2Image{sizeCache: 10, unknownFields: []byte("foo"), OriginalUrl: "original.jpg"}
+	dst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString(""), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"original_url": "original.jpg", "resized_url": ""}, dst)
+}
+
+func TestStructToMapWithTypeFormatter(t *testing.T) {
+	userDst := make(map[string]interface{})
+	mask := fieldmask_utils.MaskFromString("id,role,permissions")
+	err := fieldmask_utils.StructToMap(mask, testUserFull, userDst,
+		fieldmask_utils.WithTypeFormatter(reflect.TypeOf(testproto.Role(0)), func(v reflect.Value) interface{} {
+			return "ROLE_" + v.Interface().(testproto.Role).String()
+		}),
+		fieldmask_utils.WithTypeFormatter(reflect.TypeOf(testproto.Permission(0)), func(v reflect.Value) interface{} {
+			return v.Int()
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":          testUserFull.Id,
+		"role":        "ROLE_ADMIN",
+		"permissions": []interface{}{int64(0), int64(1)},
+	}, userDst)
+}
+
+func TestStructToMapWithEnumNameTransform(t *testing.T) {
+	userDst := make(map[string]interface{})
+	mask := fieldmask_utils.MaskFromString("id,role,permissions")
+	err := fieldmask_utils.StructToMap(mask, testUserFull, userDst,
+		fieldmask_utils.WithEnumNameTransform(strings.ToLower))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":          testUserFull.Id,
+		"role":        "admin",
+		"permissions": []interface{}{"read", "write"},
+	}, userDst)
+
+	// The transform is applied to the output of a registered formatter.
+	userDst = make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, testUserFull, userDst,
+		fieldmask_utils.WithEnumNameTransform(strings.ToLower),
+		fieldmask_utils.WithTypeFormatter(reflect.TypeOf(testproto.Role(0)), func(v reflect.Value) interface{} {
+			return "ROLE_" + v.Interface().(testproto.Role).String()
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, "role_admin", userDst["role"])
+}
+
+func TestStructToStructWithSliceMerge(t *testing.T) {
+	newDst := func() *testproto.User {
+		return &testproto.User{Images: []*testproto.Image{
+			{OriginalUrl: "dst_original1.jpg", ResizedUrl: "dst_resized1.jpg"},
+			{OriginalUrl: "dst_original2.jpg", ResizedUrl: "dst_resized2.jpg"},
+			{OriginalUrl: "dst_original3.jpg", ResizedUrl: "dst_resized3.jpg"},
+		}}
+	}
+	src := &testproto.User{Images: []*testproto.Image{
+		{OriginalUrl: "src_original1.jpg", ResizedUrl: "src_resized1.jpg"},
+		{OriginalUrl: "src_original2.jpg", ResizedUrl: "src_resized2.jpg"},
+	}}
+	mask := fieldmask_utils.MaskFromString("images{resized_url}")
+
+	testCases := []struct {
+		policy   fieldmask_utils.SliceMerge
+		expected []*testproto.Image
+	}{
+		{fieldmask_utils.SliceReplace, []*testproto.Image{
+			{ResizedUrl: "src_resized1.jpg"},
+			{ResizedUrl: "src_resized2.jpg"},
+		}},
+		{fieldmask_utils.SliceMergeTruncate, []*testproto.Image{
+			{OriginalUrl: "dst_original1.jpg", ResizedUrl: "src_resized1.jpg"},
+			{OriginalUrl: "dst_original2.jpg", ResizedUrl: "src_resized2.jpg"},
+		}},
+		{fieldmask_utils.SliceMergeKeep, []*testproto.Image{
+			{OriginalUrl: "dst_original1.jpg", ResizedUrl: "src_resized1.jpg"},
+			{OriginalUrl: "dst_original2.jpg", ResizedUrl: "src_resized2.jpg"},
+			{OriginalUrl: "dst_original3.jpg", ResizedUrl: "dst_resized3.jpg"},
+		}},
+	}
+	for _, testCase := range testCases {
+		dst := newDst()
+		err := fieldmask_utils.StructToStruct(mask, src, dst, fieldmask_utils.WithSliceMerge(testCase.policy))
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, dst.Images)
+	}
+}
+
+func TestStructToStructWithSliceMergeLongerSrc(t *testing.T) {
+	src := &testproto.User{Images: []*testproto.Image{
+		{OriginalUrl: "src_original1.jpg", ResizedUrl: "src_resized1.jpg"},
+		{OriginalUrl: "src_original2.jpg", ResizedUrl: "src_resized2.jpg"},
+	}}
+	dst := &testproto.User{Images: []*testproto.Image{
+		{OriginalUrl: "dst_original1.jpg", ResizedUrl: "dst_resized1.jpg"},
+	}}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("images{resized_url}"), src, dst,
+		fieldmask_utils.WithSliceMerge(fieldmask_utils.SliceMergeKeep))
+	require.NoError(t, err)
+	assert.Equal(t, []*testproto.Image{
+		{OriginalUrl: "dst_original1.jpg", ResizedUrl: "src_resized1.jpg"},
+		{ResizedUrl: "src_resized2.jpg"},
+	}, dst.Images)
+}
+
+func TestStructToStructEmptyMaskInverseCopiesAll(t *testing.T) {
+	for _, mask := range []fieldmask_utils.MaskInverse{{}, nil, fieldmask_utils.NewMaskInverse()} {
+		userDst := &testproto.User{}
+		err := fieldmask_utils.StructToStruct(mask, testUserFull, userDst)
+		require.NoError(t, err)
+		assert.Equal(t, testUserFull, userDst)
+	}
+}
+
+func TestStructToStructNewMaskInverse(t *testing.T) {
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.NewMaskInverse("id", "friends.username"), testUserFull, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), userDst.Id)
+	assert.Equal(t, testUserFull.Username, userDst.Username)
+	assert.Equal(t, "", userDst.Friends[0].Username)
+	assert.Equal(t, testUserFull.Friends[0].Id, userDst.Friends[0].Id)
+}
+
+type eventWithPayload struct {
+	Id      uint32           `json:"id"`
+	Payload *structpb.Struct `json:"payload"`
+	Extra   *structpb.Value  `json:"extra"`
+}
+
+func TestStructToMapWithNativeStructValues(t *testing.T) {
+	src := &eventWithPayload{
+		Id: 1,
+		Payload: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"name":    {Kind: &structpb.Value_StringValue{StringValue: "John"}},
+			"age":     {Kind: &structpb.Value_NumberValue{NumberValue: 42}},
+			"admin":   {Kind: &structpb.Value_BoolValue{BoolValue: true}},
+			"nothing": {Kind: &structpb.Value_NullValue{}},
+			"tags": {Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{Values: []*structpb.Value{
+				{Kind: &structpb.Value_StringValue{StringValue: "foo"}},
+			}}}},
+			"address": {Kind: &structpb.Value_StructValue{StructValue: &structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"city":    {Kind: &structpb.Value_StringValue{StringValue: "London"}},
+					"country": {Kind: &structpb.Value_StringValue{StringValue: "UK"}},
+				},
+			}}},
+		}},
+	}
+
+	dst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString(""), src, dst,
+		fieldmask_utils.WithNativeStructValues())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id": uint32(1),
+		"payload": map[string]interface{}{
+			"name":    "John",
+			"age":     float64(42),
+			"admin":   true,
+			"nothing": nil,
+			"tags":    []interface{}{"foo"},
+			"address": map[string]interface{}{"city": "London", "country": "UK"},
+		},
+		"extra": nil,
+	}, dst)
+
+	dst = make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("payload{name,address{city}}"), src, dst,
+		fieldmask_utils.WithNativeStructValues())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"payload": map[string]interface{}{
+			"name":    "John",
+			"address": map[string]interface{}{"city": "London"},
+		},
+	}, dst)
+}
+
+func TestStructToStructWithStructValueAdapters(t *testing.T) {
+	type event struct {
+		Id      uint32                 `json:"id"`
+		Payload map[string]interface{} `json:"payload"`
+		Extra   interface{}            `json:"extra"`
+	}
+	payload := map[string]interface{}{
+		"name":    "John",
+		"age":     float64(42),
+		"admin":   true,
+		"nothing": nil,
+		"tags":    []interface{}{"foo"},
+		"address": map[string]interface{}{"city": "London"},
+	}
+
+	dst := &eventWithPayload{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &event{Id: 1, Payload: payload, Extra: 5}, dst,
+		fieldmask_utils.WithStructValueAdapters())
+	require.NoError(t, err)
+	assert.Equal(t, &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: 5}}, dst.Extra)
+	assert.Equal(t, &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: "London"}},
+		dst.Payload.Fields["address"].GetStructValue().Fields["city"])
+
+	// Converting back gives the original value.
+	dstMap := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("payload"), dst, dstMap,
+		fieldmask_utils.WithNativeStructValues())
+	require.NoError(t, err)
+	assert.Equal(t, payload, dstMap["payload"])
+
+	dst = &eventWithPayload{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &event{}, dst, fieldmask_utils.WithStructValueAdapters())
+	require.NoError(t, err)
+	assert.Nil(t, dst.Payload)
+	assert.Equal(t, &structpb.Value{Kind: &structpb.Value_NullValue{}}, dst.Extra)
+
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &event{Extra: struct{}{}}, dst,
+		fieldmask_utils.WithStructValueAdapters())
+	assert.Error(t, err)
+
+	// The adapters are opt-in.
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &event{Payload: payload}, &eventWithPayload{})
+	assert.Error(t, err)
+}
+
+func TestClone(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,username,avatar{original_url},tags")
+	clone, err := fieldmask_utils.Clone(mask, testUserFull)
+	require.NoError(t, err)
+	require.IsType(t, &testproto.User{}, clone)
+	assert.Equal(t, &testproto.User{
+		Id:       testUserFull.Id,
+		Username: testUserFull.Username,
+		Avatar:   &testproto.Image{OriginalUrl: testUserFull.Avatar.OriginalUrl},
+		Tags:     testUserFull.Tags,
+	}, clone)
+	// The nested messages are new values.
+	assert.False(t, clone.(*testproto.User).Avatar == testUserFull.Avatar)
+}
+
+func TestCloneValue(t *testing.T) {
+	clone, err := fieldmask_utils.Clone(fieldmask_utils.MaskFromString("resized_url"), *testUserFull.Avatar)
+	require.NoError(t, err)
+	assert.Equal(t, testproto.Image{ResizedUrl: testUserFull.Avatar.ResizedUrl}, clone)
+}
+
+func TestCloneFail(t *testing.T) {
+	for _, src := range []interface{}{nil, 1, "foo"} {
+		_, err := fieldmask_utils.Clone(fieldmask_utils.Mask{}, src)
+		assert.Error(t, err)
+	}
+}
+
+func TestStructToStructWithBestEffort(t *testing.T) {
+	type Image struct {
+		OriginalUrl int    `json:"original_url"`
+		ResizedUrl  string `json:"resized_url"`
+	}
+	type User struct {
+		Id       uint32 `json:"id"`
+		Username int    `json:"username"`
+		Avatar   *Image `json:"avatar"`
+	}
+
+	mask := fieldmask_utils.MaskFromString("id,username,role,avatar")
+	userDst := &User{}
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, userDst)
+	assert.Error(t, err)
+
+	userDst = &User{}
+	err = fieldmask_utils.StructToStruct(mask, testUserFull, userDst, fieldmask_utils.WithBestEffort())
+	require.Error(t, err)
+	require.IsType(t, &fieldmask_utils.MultiError{}, err)
+	// username and avatar.original_url have different types, role does not exist in dst.
+	assert.Len(t, err.(*fieldmask_utils.MultiError).Errors, 3)
+	assert.Equal(t, &User{
+		Id:     testUserFull.Id,
+		Avatar: &Image{ResizedUrl: testUserFull.Avatar.ResizedUrl},
+	}, userDst)
+}
+
+func TestStructToStructWithBestEffortNoErrors(t *testing.T) {
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, testUserFull, userDst, fieldmask_utils.WithBestEffort())
+	assert.NoError(t, err)
+	assert.Equal(t, testUserFull, userDst)
+}
+
+func TestStructToStructOneofWithMessage(t *testing.T) {
+	src := &testproto.User{
+		Id: 1,
+		Name: &testproto.User_Profile{Profile: &testproto.Profile{
+			DisplayName: "John",
+			Avatar:      &testproto.Image{OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"},
+		}},
+	}
+
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("name{profile{display_name}}"), src, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Name: &testproto.User_Profile{Profile: &testproto.Profile{DisplayName: "John"}},
+	}, userDst)
+
+	userDst = &testproto.User{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("name{profile{avatar{resized_url}}}"), src, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Name: &testproto.User_Profile{Profile: &testproto.Profile{
+			Avatar: &testproto.Image{ResizedUrl: "resized.jpg"},
+		}},
+	}, userDst)
+}
+
+func TestStructToMapOneofWithMessage(t *testing.T) {
+	src := &testproto.User{
+		Name: &testproto.User_Profile{Profile: &testproto.Profile{DisplayName: "John"}},
+	}
+	userDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("name{profile{display_name}}"), src, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name": map[string]interface{}{"profile": map[string]interface{}{"display_name": "John"}},
+	}, userDst)
+}
+
+func TestStructToStructMapstructureTags(t *testing.T) {
+	type Image struct {
+		Url string `mapstructure:"original_url"`
+	}
+	type User struct {
+		Id     uint32 `mapstructure:"id"`
+		Name   string `mapstructure:"username"`
+		Avatar *Image `mapstructure:"avatar"`
+	}
+
+	userDst := &User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id,username,avatar{original_url}"),
+		testUserFull, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &User{
+		Id:     testUserFull.Id,
+		Name:   testUserFull.Username,
+		Avatar: &Image{Url: testUserFull.Avatar.OriginalUrl},
+	}, userDst)
+}
+
+func TestStructToStructBSONTags(t *testing.T) {
+	type Image struct {
+		Url string `bson:"original_url,omitempty"`
+	}
+	type User struct {
+		Id     uint32 `bson:"id"`
+		Avatar *Image `bson:"avatar"`
+	}
+
+	userDst := &User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id,avatar{original_url}"),
+		testUserFull, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &User{
+		Id:     testUserFull.Id,
+		Avatar: &Image{Url: testUserFull.Avatar.OriginalUrl},
+	}, userDst)
+}
+
+func TestStructToStructWithTagNames(t *testing.T) {
+	type User struct {
+		Id       uint32 `json:"id" config:"user_id"`
+		Username string `json:"username" config:"user_name"`
+	}
+	src := &User{Id: 1, Username: "johnny"}
+
+	userDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("user_id,user_name"), src, userDst,
+		fieldmask_utils.WithTagNames("config", "json"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"user_id": uint32(1), "user_name": "johnny"}, userDst)
+
+	// Tags not in the list are not consulted.
+	userDst = make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString(""), src, userDst,
+		fieldmask_utils.WithTagNames("protobuf"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Id": uint32(1), "Username": "johnny"}, userDst)
+}
+
+func TestStructToStructWithTagNamesOrder(t *testing.T) {
+	type Profile struct {
+		DisplayName string `protobuf:"bytes,1,opt,name=display_name,proto3" json:"displayName"`
+		Avatar      string `protobuf:"bytes,2,opt,name=avatar,proto3" json:"picture"`
+	}
+	src := &Profile{DisplayName: "Johnny", Avatar: "avatar.jpg"}
+
+	// protobuf is consulted before json by default.
+	dst := &Profile{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("display_name"), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &Profile{DisplayName: "Johnny"}, dst)
+
+	dst = &Profile{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("displayName,picture"), src, dst,
+		fieldmask_utils.WithTagNames("json", "protobuf"))
+	require.NoError(t, err)
+	assert.Equal(t, src, dst)
+
+	dstMap := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("display_name,displayName"), src, dstMap,
+		fieldmask_utils.WithTagNames("json", "protobuf"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"displayName": "Johnny"}, dstMap)
+}
+
+func TestStructToMapWithNilAsEmptyMap(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,avatar{original_url},name{male_name}")
+
+	userDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(mask, testUserPartial, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": testUserPartial.Id, "avatar": nil, "name": nil}, userDst)
+
+	userDst = make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, testUserPartial, userDst, fieldmask_utils.WithNilAsEmptyMap())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":     testUserPartial.Id,
+		"avatar": map[string]interface{}{},
+		"name":   nil,
+	}, userDst)
+}
+
+func TestStructToMapWithNilShape(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,avatar{original_url,resized_url},images{original_url},name{male_name}")
+
+	userDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(mask, testUserPartial, userDst, fieldmask_utils.WithNilShape())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":     testUserPartial.Id,
+		"avatar": map[string]interface{}{"original_url": nil, "resized_url": nil},
+		"images": []map[string]interface{}{},
+		"name":   nil,
+	}, userDst)
+
+	// The messages selected entirely are still nil, nested messages keep their shape too.
+	src := &testproto.UpdateUserRequest{}
+	dst := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("user{id,avatar{original_url},tags,friends}"),
+		src, dst, fieldmask_utils.WithNilShape())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":      nil,
+			"avatar":  map[string]interface{}{"original_url": nil},
+			"tags":    nil,
+			"friends": nil,
+		},
+	}, dst)
+
+	var buf bytes.Buffer
+	require.NoError(t, fieldmask_utils.StructToJSONStream(mask, testUserPartial, &buf, fieldmask_utils.WithNilShape()))
+	expected, err := json.Marshal(userDst)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+}
+
+func TestStructToStructWithRawJSON(t *testing.T) {
+	type UserRecord struct {
+		Id     uint32          `json:"id"`
+		Avatar json.RawMessage `json:"avatar"`
+		Tags   json.RawMessage `json:"tags"`
+	}
+
+	mask := fieldmask_utils.MaskFromString("id,avatar{original_url},tags")
+	userDst := &UserRecord{}
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, userDst, fieldmask_utils.WithRawJSON())
+	require.NoError(t, err)
+	assert.Equal(t, testUserFull.Id, userDst.Id)
+	assert.JSONEq(t, `{"original_url": "original.jpg"}`, string(userDst.Avatar))
+	assert.JSONEq(t, `["tag1", "tag2", "tag3"]`, string(userDst.Tags))
+
+	// Nil messages are stored as nil.
+	userDst = &UserRecord{Avatar: json.RawMessage(`{}`)}
+	err = fieldmask_utils.StructToStruct(mask, testUserPartial, userDst, fieldmask_utils.WithRawJSON())
+	require.NoError(t, err)
+	assert.Nil(t, userDst.Avatar)
+
+	// Without the option the types are incompatible.
+	err = fieldmask_utils.StructToStruct(mask, testUserFull, &UserRecord{})
+	assert.Error(t, err)
+}
+
+func TestStructToStructWithRawJSONMessageCollections(t *testing.T) {
+	type UserRecord struct {
+		Images json.RawMessage `json:"images"`
+		Photos json.RawMessage `json:"photos"`
+	}
+	src := &testproto.User{
+		Images: testUserFull.Images,
+		Photos: map[string]*testproto.Image{"cover": {OriginalUrl: "cover.jpg", ResizedUrl: "cover_resized.jpg"}},
+	}
+
+	mask := fieldmask_utils.MaskFromString("images{original_url},photos{original_url}")
+	userDst := &UserRecord{}
+	err := fieldmask_utils.StructToStruct(mask, src, userDst, fieldmask_utils.WithRawJSON())
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"original_url": "original_image1.jpg"}, {"original_url": "original_image2.jpg"}]`,
+		string(userDst.Images))
+	assert.JSONEq(t, `{"cover": {"original_url": "cover.jpg"}}`, string(userDst.Photos))
+}
+
+func TestStructToStructNilSrc(t *testing.T) {
+	userDst := &testproto.User{Id: 1}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, (*testproto.User)(nil), userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{Id: 1}, userDst)
+
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, nil, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{Id: 1}, userDst)
+
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, (*testproto.User)(nil), userDst,
+		fieldmask_utils.WithErrorOnNilSrc())
+	assert.Error(t, err)
+}
+
+func TestStructToMapNilSrc(t *testing.T) {
+	userDst := map[string]interface{}{"id": 1}
+	err := fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, (*testproto.User)(nil), userDst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": 1}, userDst)
+
+	err = fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, (*testproto.User)(nil), userDst,
+		fieldmask_utils.WithErrorOnNilSrc())
+	assert.Error(t, err)
+}
+
+func TestStructToStructWithAtomic(t *testing.T) {
+	type SrcImage struct {
+		OriginalUrl string       `json:"original_url"`
+		Caption     fmt.Stringer `json:"caption"`
+	}
+	type SrcUser struct {
+		Id     uint32      `json:"id"`
+		Tags   []string    `json:"tags"`
+		Images []*SrcImage `json:"images"`
+	}
+	type Image struct {
+		OriginalUrl string `json:"original_url"`
+		Caption     Name   `json:"caption"`
+	}
+	type User struct {
+		Id     uint32   `json:"id"`
+		Tags   []string `json:"tags"`
+		Images []*Image `json:"images"`
+	}
+	src := &SrcUser{
+		Id:   1,
+		Tags: []string{"tag1"},
+		Images: []*SrcImage{
+			{OriginalUrl: "original1.jpg"},
+			// fmt.Stringer does not implement Name, so the second item fails to be copied.
+			{OriginalUrl: "original2.jpg", Caption: &FemaleName{FemaleName: "Dana"}},
+		},
+	}
+	mask := fieldmask_utils.MaskFromString("id,tags,images")
+
+	userDst := &User{Id: 2}
+	err := fieldmask_utils.StructToStruct(mask, src, userDst)
+	assert.Error(t, err)
+	// Without the option dst is left partially populated.
+	assert.Equal(t, src.Id, userDst.Id)
+
+	userDst = &User{Id: 2, Images: []*Image{{OriginalUrl: "dst.jpg"}}}
+	err = fieldmask_utils.StructToStruct(mask, src, userDst, fieldmask_utils.WithAtomic())
+	assert.Error(t, err)
+	assert.Equal(t, &User{Id: 2, Images: []*Image{{OriginalUrl: "dst.jpg"}}}, userDst)
+
+	userDst = &User{Id: 2, Images: []*Image{{OriginalUrl: "dst.jpg"}}}
+	err = fieldmask_utils.StructToStruct(mask, src, userDst, fieldmask_utils.WithAtomic(),
+		fieldmask_utils.WithBestEffort())
+	assert.Error(t, err)
+	assert.Equal(t, &User{Id: 2, Images: []*Image{{OriginalUrl: "dst.jpg"}}}, userDst)
+
+	userDst = &User{Id: 2}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("tags,images{original_url}"), src, userDst,
+		fieldmask_utils.WithAtomic())
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 2, Tags: src.Tags, Images: []*Image{
+		{OriginalUrl: "original1.jpg"},
+		{OriginalUrl: "original2.jpg"},
+	}}, userDst)
+}
+
+// Role mimics testproto.Role generated in a different package.
+type Role int32
+
+const (
+	Role_UNKNOWN Role = 0
+	Role_REGULAR Role = 1
+)
+
+var Role_name = map[int32]string{0: "UNKNOWN", 1: "REGULAR"}
+
+func TestStructToStructEnumConversion(t *testing.T) {
+	type User struct {
+		Id   uint32 `json:"id"`
+		Role Role   `json:"role"`
+		Prev *Role  `json:"prev_role"`
+	}
+	type SrcUser struct {
+		Role     testproto.Role `json:"role"`
+		PrevRole testproto.Role `json:"prev_role"`
+	}
+
+	userDst := &User{}
+	src := &SrcUser{Role: testproto.Role_REGULAR, PrevRole: testproto.Role_UNKNOWN}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, src, userDst)
+	require.NoError(t, err)
+	require.NotNil(t, userDst.Prev)
+	assert.Equal(t, Role_REGULAR, userDst.Role)
+	assert.Equal(t, Role_UNKNOWN, *userDst.Prev)
+
+	// Only the types with the same underlying kind are converted.
+	type Uint32Role struct {
+		Role uint32 `json:"role"`
+	}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &SrcUser{}, &Uint32Role{})
+	assert.Error(t, err)
+}
+
+// Permission mimics testproto.Permission generated in a different package.
+type Permission int32
+
+func TestStructToStructRepeatedEnumConversion(t *testing.T) {
+	type User struct {
+		Permissions []Permission `json:"permissions"`
+	}
+
+	userDst := &User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("permissions"), testUserFull, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, []Permission{0, 1}, userDst.Permissions)
+
+	// And back.
+	protoDst := &testproto.User{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, userDst, protoDst)
+	require.NoError(t, err)
+	assert.Equal(t, testUserFull.Permissions, protoDst.Permissions)
+
+	userDst = &User{Permissions: []Permission{2}}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("permissions"), testUserPartial, userDst)
+	require.NoError(t, err)
+	assert.Nil(t, userDst.Permissions)
+
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("permissions"), testUserFull, &User{},
+		fieldmask_utils.WithStrictTypes())
+	assert.Error(t, err)
+}
+
+func TestStructToStructEnumValidator(t *testing.T) {
+	type User struct {
+		Role Role `json:"role"`
+	}
+	validator := fieldmask_utils.WithEnumValidator(reflect.TypeOf(Role(0)), func(v reflect.Value) bool {
+		_, ok := Role_name[int32(v.Int())]
+		return ok
+	})
+
+	userDst := &User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("role"),
+		&testproto.User{Role: testproto.Role_REGULAR}, userDst, validator)
+	require.NoError(t, err)
+	assert.Equal(t, Role_REGULAR, userDst.Role)
+
+	// testproto.Role_ADMIN is not defined in Role.
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("role"),
+		&testproto.User{Role: testproto.Role_ADMIN}, &User{}, validator)
+	assert.Error(t, err)
+}
+
+func TestStructToMapWithFlattenOneof(t *testing.T) {
+	userDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("id,name{male_name}"), testUserFull, userDst,
+		fieldmask_utils.WithFlattenOneof())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": testUserFull.Id, "male_name": "John"}, userDst)
+
+	// The variant that is not selected by the mask is not emitted.
+	userDst = make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("name{female_name}"), testUserFull, userDst,
+		fieldmask_utils.WithFlattenOneof())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, userDst)
+
+	// Unset oneofs are omitted.
+	userDst = make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("id,name"), testUserPartial, userDst,
+		fieldmask_utils.WithFlattenOneof())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": testUserPartial.Id}, userDst)
+}
+
+func TestStructToStructSliceOfDistinctTypes(t *testing.T) {
+	type ImageV1 struct {
+		Url   string `json:"url"`
+		Thumb string `json:"thumbnail_url"`
+	}
+	type ImageV2 struct {
+		SourceUrl    string `json:"url"`
+		ThumbnailUrl string `protobuf:"bytes,2,opt,name=thumbnail_url,proto3"`
+	}
+	type AlbumV1 struct {
+		Images []*ImageV1 `json:"images"`
+	}
+	type AlbumV2 struct {
+		Images []*ImageV2 `json:"images"`
+	}
+
+	src := &AlbumV1{Images: []*ImageV1{
+		{Url: "image1.jpg", Thumb: "thumb1.jpg"},
+		{Url: "image2.jpg", Thumb: "thumb2.jpg"},
+	}}
+
+	dst := &AlbumV2{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("images{thumbnail_url}"), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &AlbumV2{Images: []*ImageV2{
+		{ThumbnailUrl: "thumb1.jpg"},
+		{ThumbnailUrl: "thumb2.jpg"},
+	}}, dst)
+
+	dst = &AlbumV2{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString(""), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &AlbumV2{Images: []*ImageV2{
+		{SourceUrl: "image1.jpg", ThumbnailUrl: "thumb1.jpg"},
+		{SourceUrl: "image2.jpg", ThumbnailUrl: "thumb2.jpg"},
+	}}, dst)
+}
+
+func TestStructToStructValueSliceOfDistinctTypes(t *testing.T) {
+	type ImageV1 struct {
+		Url   string `json:"url"`
+		Thumb string `json:"thumbnail_url"`
+	}
+	type ImageV2 struct {
+		ThumbnailUrl string `json:"thumbnail_url"`
+	}
+	src := &struct {
+		Images []ImageV1 `json:"images"`
+	}{Images: []ImageV1{{Url: "image1.jpg", Thumb: "thumb1.jpg"}}}
+	dst := &struct {
+		Images []ImageV2 `json:"images"`
+	}{}
+
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("images{thumbnail_url}"), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, []ImageV2{{ThumbnailUrl: "thumb1.jpg"}}, dst.Images)
+}
+
+func TestStructToStructWithStrictTypes(t *testing.T) {
+	type Int32User struct {
+		Id   int32          `json:"id"`
+		Role testproto.Role `json:"role"`
+	}
+	type Int64User struct {
+		Id int64 `json:"id"`
+	}
+	type UserId int32
+	type NamedIdUser struct {
+		Id UserId `json:"id"`
+	}
+	type RoleUser struct {
+		Role Role `json:"role"`
+	}
+	src := &Int32User{Id: 1, Role: testproto.Role_REGULAR}
+
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id"), src, &Int64User{},
+		fieldmask_utils.WithStrictTypes())
+	assert.Error(t, err)
+
+	// The distinct types of the same kind are converted unless the types are strict.
+	idDst := &NamedIdUser{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id"), src, idDst)
+	require.NoError(t, err)
+	assert.Equal(t, UserId(1), idDst.Id)
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id"), src, &NamedIdUser{},
+		fieldmask_utils.WithStrictTypes())
+	assert.Error(t, err)
+
+	roleDst := &RoleUser{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("role"), src, roleDst)
+	require.NoError(t, err)
+	assert.Equal(t, Role(testproto.Role_REGULAR), roleDst.Role)
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("role"), src, &RoleUser{},
+		fieldmask_utils.WithStrictTypes())
+	assert.Error(t, err)
+
+	// Same types are fine.
+	userDst := &Int32User{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, src, userDst, fieldmask_utils.WithStrictTypes())
+	require.NoError(t, err)
+	assert.Equal(t, src, userDst)
+}
+
+type userGroup struct {
+	Name    string            `json:"name"`
+	Members []*testproto.User `json:"members"`
+}
+
+type organization struct {
+	Groups map[string]*userGroup `json:"groups"`
+}
+
+type organizationValues struct {
+	Groups map[string]userGroup `json:"groups"`
+}
+
+func TestStructToStructMapOfMessagesWithSlice(t *testing.T) {
+	src := &organization{
+		Groups: map[string]*userGroup{
+			"admins": {Name: "Admins", Members: []*testproto.User{testUserFull}},
+			"empty":  nil,
+		},
+	}
+
+	mask := fieldmask_utils.MaskFromString("groups{members{id}}")
+	dst := &organization{}
+	err := fieldmask_utils.StructToStruct(mask, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &organization{
+		Groups: map[string]*userGroup{
+			"admins": {Members: []*testproto.User{{Id: testUserFull.Id}}},
+			"empty":  nil,
+		},
+	}, dst)
+
+	valuesDst := &organizationValues{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("groups{name}"), src, valuesDst)
+	require.NoError(t, err)
+	assert.Equal(t, &organizationValues{
+		Groups: map[string]userGroup{
+			"admins": {Name: "Admins"},
+			"empty":  {},
+		},
+	}, valuesDst)
+}
+
+type labelsEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type legacyResource struct {
+	Id     int64          `json:"id"`
+	Labels []*labelsEntry `json:"labels"`
+}
+
+type resource struct {
+	Id     int64             `json:"id"`
+	Labels map[string]string `json:"labels"`
+}
+
+func TestStructToStructWithMapEntryAdapter(t *testing.T) {
+	src := &legacyResource{
+		Id:     1,
+		Labels: []*labelsEntry{{Key: "env", Value: "prod"}, nil, {Key: "team", Value: "core"}},
+	}
+
+	dst := &resource{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("labels"), src, dst,
+		fieldmask_utils.WithMapEntryAdapter("labels"))
+	require.NoError(t, err)
+	assert.Equal(t, &resource{Labels: map[string]string{"env": "prod", "team": "core"}}, dst)
+
+	// Without the adapter the types do not match.
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("labels"), src, &resource{})
+	assert.Error(t, err)
+}
+
+type flatUser struct {
+	Id         uint32 `json:"id"`
+	MaleName   string `json:"male_name"`
+	FemaleName string `json:"female_name"`
+}
+
+func TestStructToStructWithUnwrapOneof(t *testing.T) {
+	src := &testproto.User{Id: 1, Name: &testproto.User_MaleName{MaleName: "John"}}
+
+	dst := &flatUser{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id,name{male_name}"), src, dst,
+		fieldmask_utils.WithUnwrapOneof())
+	require.NoError(t, err)
+	assert.Equal(t, &flatUser{Id: 1, MaleName: "John"}, dst)
+
+	// Unset oneofs are skipped.
+	dst = &flatUser{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("name"), &testproto.User{}, dst,
+		fieldmask_utils.WithUnwrapOneof())
+	require.NoError(t, err)
+	assert.Equal(t, &flatUser{}, dst)
+
+	// Without the option dst must have the oneof field.
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("name{male_name}"), src, &flatUser{})
+	assert.Error(t, err)
+}
+
+func TestStructToStructIfChanged(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,username,avatar{original_url}")
+	src := &testproto.User{Id: 1, Username: "johnny", Avatar: &testproto.Image{OriginalUrl: "original.jpg"}}
+
+	avatar := &testproto.Image{OriginalUrl: "original.jpg"}
+	dst := &testproto.User{Id: 1, Username: "johnny", Avatar: avatar}
+	changed, err := fieldmask_utils.StructToStructIfChanged(mask, src, dst)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	// dst is left untouched.
+	assert.True(t, avatar == dst.Avatar)
+
+	src.Username = "john"
+	changed, err = fieldmask_utils.StructToStructIfChanged(mask, src, dst)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "john", dst.Username)
+}
+
+func TestStructToStructIfChangedFail(t *testing.T) {
+	_, err := fieldmask_utils.StructToStructIfChanged(fieldmask_utils.Mask{}, testUserFull, testproto.User{})
+	assert.Error(t, err)
+
+	_, err = fieldmask_utils.StructToStructIfChanged(fieldmask_utils.MaskFromString("id"), testUserFull, &struct{}{})
+	assert.Error(t, err)
+}
+
+func TestStructToStructWithProtoJSONNames(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,avatar{originalUrl},name{maleName}")
+	src := &testproto.User{
+		Id:     1,
+		Avatar: &testproto.Image{OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"},
+		Name:   &testproto.User_MaleName{MaleName: "John"},
+	}
+
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(mask, src, userDst, fieldmask_utils.WithProtoJSONNames())
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:     1,
+		Avatar: &testproto.Image{OriginalUrl: "original.jpg"},
+		Name:   &testproto.User_MaleName{MaleName: "John"},
+	}, userDst)
+
+	mapDst := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, src, mapDst, fieldmask_utils.WithProtoJSONNames())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":     uint32(1),
+		"avatar": map[string]interface{}{"originalUrl": "original.jpg"},
+		"name":   map[string]interface{}{"maleName": "John"},
+	}, mapDst)
+
+	// The JSON names are not used by default.
+	userDst = &testproto.User{}
+	err = fieldmask_utils.StructToStruct(mask, src, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:     1,
+		Avatar: &testproto.Image{},
+		Name:   &testproto.User_MaleName{},
+	}, userDst)
+}
+
+func TestStructToStructAnonymousSrc(t *testing.T) {
+	src := struct {
+		Id     uint32 `json:"id"`
+		Login  string `json:"username"`
+		Avatar *struct {
+			Url string `json:"original_url"`
+		} `json:"avatar"`
+	}{
+		Id:    1,
+		Login: "johnny",
+		Avatar: &struct {
+			Url string `json:"original_url"`
+		}{Url: "original.jpg"},
+	}
+
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, src, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:       1,
+		Username: "johnny",
+		Avatar:   &testproto.Image{OriginalUrl: "original.jpg"},
+	}, userDst)
+
+	anonymousDst := &struct {
+		Id uint32 `json:"id"`
+	}{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id,username"), src, anonymousDst)
+	require.Error(t, err)
+	assert.Equal(t, "target field username is not present in dst *struct { ... }", err.Error())
+}
+
+func TestStructToStructNotStructSrc(t *testing.T) {
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, "johnny", &testproto.User{})
+	require.Error(t, err)
+	assert.Equal(t, "src must be a struct or a pointer to a struct, got string", err.Error())
+}
+
+func TestStructToStructNilAndEmptySlices(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("tags,friends,permissions")
+	testCases := []struct {
+		policy   fieldmask_utils.EmptySlices
+		src      *testproto.User
+		expected *testproto.User
+	}{
+		{
+			fieldmask_utils.EmptySlicesPreserve,
+			&testproto.User{},
+			&testproto.User{},
+		},
+		{
+			fieldmask_utils.EmptySlicesPreserve,
+			&testproto.User{Tags: []string{}, Friends: []*testproto.User{}, Permissions: []testproto.Permission{}},
+			&testproto.User{Tags: []string{}, Friends: []*testproto.User{}, Permissions: []testproto.Permission{}},
+		},
+		{
+			fieldmask_utils.EmptySlicesAsNil,
+			&testproto.User{Tags: []string{}, Friends: []*testproto.User{}, Permissions: []testproto.Permission{}},
+			&testproto.User{},
+		},
+		{
+			fieldmask_utils.EmptySlicesAsEmpty,
+			&testproto.User{},
+			&testproto.User{Tags: []string{}, Friends: []*testproto.User{}, Permissions: []testproto.Permission{}},
+		},
+	}
+	for _, testCase := range testCases {
+		userDst := &testproto.User{}
+		err := fieldmask_utils.StructToStruct(mask, testCase.src, userDst,
+			fieldmask_utils.WithEmptySlices(testCase.policy))
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected.Tags == nil, userDst.Tags == nil, testCase.policy)
+		assert.Equal(t, testCase.expected.Friends == nil, userDst.Friends == nil, testCase.policy)
+		assert.Equal(t, testCase.expected.Permissions == nil, userDst.Permissions == nil, testCase.policy)
+		assert.Equal(t, testCase.expected, userDst)
+	}
+}
+
+type boxedUser struct {
+	Id      interface{} `json:"id"`
+	Avatar  interface{} `json:"avatar"`
+	Friends interface{} `json:"friends"`
+	Name    interface{} `json:"name"`
+}
+
+func TestStructToStructInterfaceDst(t *testing.T) {
+	type Image struct {
+		OriginalUrl string `json:"original_url"`
+		ResizedUrl  string `json:"resized_url"`
+	}
+	type User struct {
+		Id      uint32            `json:"id"`
+		Avatar  Image             `json:"avatar"`
+		Friends []*testproto.User `json:"friends"`
+		Name    interface{}       `json:"name"`
+	}
+	src := &User{
+		Id:      1,
+		Avatar:  Image{OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"},
+		Friends: []*testproto.User{{Id: 2, Username: "friend"}},
+		Name:    &testproto.User_MaleName{MaleName: "John"},
+	}
+
+	dst := &boxedUser{}
+	err := fieldmask_utils.StructToStruct(
+		fieldmask_utils.MaskFromString("id,avatar{original_url},friends{id},name"), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &boxedUser{
+		Id:      uint32(1),
+		Avatar:  Image{OriginalUrl: "original.jpg"},
+		Friends: []*testproto.User{{Id: 2}},
+		Name:    &testproto.User_MaleName{MaleName: "John"},
+	}, dst)
+
+	// The copied values do not share the memory with src.
+	dst.Friends.([]*testproto.User)[0].Id = 3
+	assert.Equal(t, uint32(2), src.Friends[0].Id)
+
+	// Nil values stay nil.
+	dst = &boxedUser{Friends: "stale"}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("friends,name"), &User{}, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &boxedUser{}, dst)
+}
+
+func TestStructToStructInterfaceDstWithUnexportedState(t *testing.T) {
+	type Event struct {
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type BoxedEvent struct {
+		CreatedAt interface{} `json:"created_at"`
+	}
+	src := &Event{CreatedAt: time.Date(2020, 4, 1, 12, 30, 0, 0, time.UTC)}
+
+	// The structs that are not messages are boxed by value.
+	dst := &BoxedEvent{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("created_at"), src, dst)
+	require.NoError(t, err)
+	require.IsType(t, time.Time{}, dst.CreatedAt)
+	assert.True(t, src.CreatedAt.Equal(dst.CreatedAt.(time.Time)))
+}
+
+type immutableUser struct {
+	id       uint32
+	username string
+	avatar   *testproto.Image
+	internal string
+}
+
+func (u *immutableUser) GetId() uint32               { return u.id }
+func (u *immutableUser) GetUsername() string         { return u.username }
+func (u *immutableUser) GetAvatar() *testproto.Image { return u.avatar }
+
+func TestStructToStructWithGetters(t *testing.T) {
+	src := &immutableUser{
+		id:       1,
+		username: "johnny",
+		avatar:   &testproto.Image{OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"},
+		internal: "secret",
+	}
+
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id,username,avatar{original_url}"), src,
+		userDst, fieldmask_utils.WithGetters())
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:       1,
+		Username: "johnny",
+		Avatar:   &testproto.Image{OriginalUrl: "original.jpg"},
+	}, userDst)
+
+	// Unexported fields without getters are still ignored.
+	mapDst := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskInverse{"avatar": nil}, *src, mapDst,
+		fieldmask_utils.WithGetters())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": uint32(1), "username": "johnny"}, mapDst)
+}
+
+func TestStructToStructWithResetDst(t *testing.T) {
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id,username,avatar{original_url}"),
+		testUserFull, userDst, fieldmask_utils.WithResetDst())
+	require.NoError(t, err)
+
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("role,avatar{resized_url}"),
+		testUserFull, userDst, fieldmask_utils.WithResetDst())
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Role:   testUserFull.Role,
+		Avatar: &testproto.Image{ResizedUrl: testUserFull.Avatar.ResizedUrl},
+	}, userDst)
+}
+
+func TestStructToMapMapOfMessages(t *testing.T) {
+	src := &testproto.User{
+		Id: 1,
+		Photos: map[string]*testproto.Image{
+			"profile": {OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"},
+			"missing": nil,
+		},
+	}
+
+	mapDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("id,photos{resized_url}"), src, mapDst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id": uint32(1),
+		"photos": map[string]interface{}{
+			"profile": map[string]interface{}{"resized_url": "resized.jpg"},
+			"missing": nil,
+		},
+	}, mapDst)
+}
+
+func TestStructToStructWithLogger(t *testing.T) {
+	var events []string
+	logger := fieldmask_utils.WithLogger(func(format string, args ...interface{}) {
+		events = append(events, fmt.Sprintf(format, args...))
+	})
+	src := &testproto.User{Id: 1, Avatar: &testproto.Image{OriginalUrl: "original.jpg"}}
+	mask := fieldmask_utils.MaskFromString("id,avatar{original_url}")
+
+	err := fieldmask_utils.StructToStruct(mask, src, &testproto.User{}, logger)
+	require.NoError(t, err)
+	assert.Contains(t, events, "copying id")
+	assert.Contains(t, events, "skipping username: not selected by the filter")
+	assert.Contains(t, events, "copying avatar")
+	assert.Contains(t, events, "entering avatar")
+	assert.Contains(t, events, "copying avatar.original_url")
+	assert.Contains(t, events, "skipping avatar.resized_url: not selected by the filter")
+
+	events = nil
+	err = fieldmask_utils.StructToMap(mask, src, make(map[string]interface{}), logger)
+	require.NoError(t, err)
+	assert.Contains(t, events, "copying avatar.original_url")
+	assert.Contains(t, events, "skipping avatar.resized_url: not selected by the filter")
+}
+
+func TestStructToStructValueSrcToPtrDst(t *testing.T) {
+	type Image struct {
+		OriginalUrl string `json:"original_url"`
+		ResizedUrl  string `json:"resized_url"`
+	}
+	type ValueUser struct {
+		Deactivated bool  `json:"deactivated"`
+		Avatar      Image `json:"avatar"`
+	}
+	type OptionalUser struct {
+		Deactivated *bool            `json:"deactivated"`
+		Avatar      *testproto.Image `json:"avatar"`
+	}
+	src := &ValueUser{
+		Deactivated: true,
+		Avatar:      Image{OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"},
+	}
+
+	dst := &OptionalUser{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("deactivated,avatar{original_url}"), src, dst)
+	require.NoError(t, err)
+	deactivated := true
+	assert.Equal(t, &OptionalUser{
+		Deactivated: &deactivated,
+		Avatar:      &testproto.Image{OriginalUrl: "original.jpg"},
+	}, dst)
+
+	// Pointers to scalars are copied to new pointers.
+	optionalDst := &OptionalUser{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("deactivated"), dst, optionalDst)
+	require.NoError(t, err)
+	assert.Equal(t, &OptionalUser{Deactivated: &deactivated}, optionalDst)
+	assert.False(t, dst.Deactivated == optionalDst.Deactivated)
+}
+
+func TestStructToStructTimeSrcToPtrDst(t *testing.T) {
+	type Event struct {
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type OptionalEvent struct {
+		CreatedAt *time.Time `json:"created_at"`
+	}
+	src := &Event{CreatedAt: time.Date(2020, 4, 1, 12, 30, 0, 0, time.UTC)}
+
+	// The unexported state of time.Time is kept.
+	dst := &OptionalEvent{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("created_at"), src, dst)
+	require.NoError(t, err)
+	require.NotNil(t, dst.CreatedAt)
+	assert.True(t, src.CreatedAt.Equal(*dst.CreatedAt))
+}
+
+func TestStructToMapWithDurationStrings(t *testing.T) {
+	type Config struct {
+		Name    string          `json:"name"`
+		Timeout time.Duration   `json:"timeout"`
+		Retries []time.Duration `json:"retries"`
+	}
+	src := &Config{Name: "api", Timeout: 1500 * time.Millisecond, Retries: []time.Duration{time.Second, time.Minute}}
+
+	mapDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, src, mapDst, fieldmask_utils.WithDurationStrings())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":    "api",
+		"timeout": "1.5s",
+		"retries": []interface{}{"1s", "1m0s"},
+	}, mapDst)
+
+	// Durations are numbers by default.
+	mapDst = make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("timeout"), src, mapDst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"timeout": 1500 * time.Millisecond}, mapDst)
+}
+
+func TestStructToStructSliceToArray(t *testing.T) {
+	type Gallery struct {
+		Images [2]*testproto.Image `json:"images"`
+		Tags   [2]string           `json:"tags"`
+	}
+	src := &testproto.User{
+		Images: []*testproto.Image{
+			{OriginalUrl: "1.jpg", ResizedUrl: "1_resized.jpg"},
+			{OriginalUrl: "2.jpg", ResizedUrl: "2_resized.jpg"},
+			{OriginalUrl: "3.jpg", ResizedUrl: "3_resized.jpg"},
+		},
+		Tags: []string{"a"},
+	}
+	mask := fieldmask_utils.MaskFromString("images{original_url},tags")
+
+	dst := &Gallery{}
+	err := fieldmask_utils.StructToStruct(mask, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &Gallery{
+		Images: [2]*testproto.Image{{OriginalUrl: "1.jpg"}, {OriginalUrl: "2.jpg"}},
+		Tags:   [2]string{"a", ""},
+	}, dst)
+
+	err = fieldmask_utils.StructToStruct(mask, src, &Gallery{}, fieldmask_utils.WithErrorOnArrayOverflow())
+	assert.Error(t, err)
+
+	// Arrays are copied to slices.
+	userDst := &testproto.User{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("images{original_url},tags"), dst, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Images: []*testproto.Image{{OriginalUrl: "1.jpg"}, {OriginalUrl: "2.jpg"}},
+		Tags:   []string{"a", ""},
+	}, userDst)
+}
+
+func TestStructToMapWithSortedMapEntries(t *testing.T) {
+	src := &testproto.User{
+		Meta: map[string]string{"b": "2", "c": "3", "a": "1"},
+		Photos: map[string]*testproto.Image{
+			"profile": {OriginalUrl: "profile.jpg", ResizedUrl: "profile_resized.jpg"},
+			"cover":   {OriginalUrl: "cover.jpg"},
+		},
+	}
+
+	mapDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("meta,photos{original_url}"), src, mapDst,
+		fieldmask_utils.WithSortedMapEntries())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"meta": []fieldmask_utils.KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}, {Key: "c", Value: "3"}},
+		"photos": []fieldmask_utils.KeyValue{
+			{Key: "cover", Value: map[string]interface{}{"original_url": "cover.jpg"}},
+			{Key: "profile", Value: map[string]interface{}{"original_url": "profile.jpg"}},
+		},
+	}, mapDst)
+}
+
+func TestStructToStructInterfaceDstWithMessageCollections(t *testing.T) {
+	type Album struct {
+		Images interface{} `json:"images"`
+		Photos interface{} `json:"photos"`
+	}
+	src := &testproto.User{
+		Images: []*testproto.Image{{OriginalUrl: "1.jpg", ResizedUrl: "1_resized.jpg"}},
+		Photos: map[string]*testproto.Image{"cover": {OriginalUrl: "cover.jpg", ResizedUrl: "cover_resized.jpg"}},
+	}
+
+	dst := &Album{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("images{original_url},photos{resized_url}"),
+		src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &Album{
+		Images: []*testproto.Image{{OriginalUrl: "1.jpg"}},
+		Photos: map[string]*testproto.Image{"cover": {ResizedUrl: "cover_resized.jpg"}},
+	}, dst)
+}
+
+type searchResponseResult struct {
+	Url   *string `protobuf:"bytes,2,req,name=url" json:"url,omitempty"`
+	Title *string `protobuf:"bytes,3,opt,name=title" json:"title,omitempty"`
+}
+
+type searchResponse struct {
+	Result []*searchResponseResult `protobuf:"group,1,rep,name=Result,json=result" json:"result,omitempty"`
+	Top    *searchResponseResult   `protobuf:"group,4,opt"`
+}
+
+func TestStructToStructProto2Groups(t *testing.T) {
+	url, title := "https://example.com", "Example"
+	src := &searchResponse{
+		Result: []*searchResponseResult{{Url: &url, Title: &title}},
+		Top:    &searchResponseResult{Url: &url, Title: &title},
+	}
+	mask := fieldmask_utils.MaskFromString("result{url},top{title}")
+
+	dst := &searchResponse{}
+	err := fieldmask_utils.StructToStruct(mask, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &searchResponse{
+		Result: []*searchResponseResult{{Url: &url}},
+		Top:    &searchResponseResult{Title: &title},
+	}, dst)
+
+	mapDst := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, src, mapDst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"result": []map[string]interface{}{{"url": url}},
+		"top":    map[string]interface{}{"title": title},
+	}, mapDst)
+}
+
+func TestCopyCommonFields(t *testing.T) {
+	type Image struct {
+		Url       string `json:"original_url"`
+		Thumbnail string `json:"thumbnail_url"`
+	}
+	type UserSummary struct {
+		Id       uint32 `json:"id"`
+		Username string `json:"username"`
+		Avatar   *Image `json:"avatar"`
+		Rating   int    `json:"rating"`
+	}
+
+	dst := &UserSummary{Rating: 5}
+	err := fieldmask_utils.CopyCommonFields(testUserFull, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &UserSummary{
+		Id:       testUserFull.Id,
+		Username: testUserFull.Username,
+		Avatar:   &Image{Url: testUserFull.Avatar.OriginalUrl},
+		Rating:   5,
+	}, dst)
+
+	// Types without common fields are ignored.
+	err = fieldmask_utils.CopyCommonFields(testUserFull, &struct{ Other string }{})
+	require.NoError(t, err)
+}
+
+func TestStructToMapWithKeyRenames(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,avatar{original_url,resized_url}")
+	renames := fieldmask_utils.WithKeyRenames(map[string]string{"avatar.original_url": "url"})
+
+	mapDst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(mask, testUserFull, mapDst, renames)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id": testUserFull.Id,
+		"avatar": map[string]interface{}{
+			"url":         testUserFull.Avatar.OriginalUrl,
+			"resized_url": testUserFull.Avatar.ResizedUrl,
+		},
+	}, mapDst)
+
+	var buf bytes.Buffer
+	require.NoError(t, fieldmask_utils.StructToJSONStream(mask, testUserFull, &buf, renames))
+	expected, err := json.Marshal(mapDst)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), buf.String())
+}
+
+// uuid is a gogoproto.customtype style type.
+type uuid struct {
+	high, low uint64
+}
+
+func (u uuid) Marshal() ([]byte, error) {
+	data := make([]byte, 16)
+	_, err := u.MarshalTo(data)
+	return data, err
+}
+
+func (u *uuid) MarshalTo(data []byte) (int, error) {
+	for i := 0; i < 8; i++ {
+		data[i], data[8+i] = byte(u.high>>(56-8*i)), byte(u.low>>(56-8*i))
+	}
+	return 16, nil
+}
+
+func (u *uuid) Unmarshal(data []byte) error {
+	for i := 0; i < 8; i++ {
+		u.high, u.low = u.high<<8|uint64(data[i]), u.low<<8|uint64(data[8+i])
+	}
+	return nil
+}
+
+func (u *uuid) Size() int { return 16 }
+
+type location struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type account struct {
+	Id       uuid      `json:"id"`
+	ParentId *uuid     `json:"parent_id"`
+	Location *location `json:"location"`
+}
+
+func TestStructToStructCustomTypes(t *testing.T) {
+	src := &account{
+		Id:       uuid{high: 1, low: 2},
+		ParentId: &uuid{high: 3, low: 4},
+		Location: &location{Lat: 1, Lng: 2},
+	}
+
+	dst := &account{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id{high},parent_id"), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &account{Id: src.Id, ParentId: src.ParentId}, dst)
+	assert.False(t, src.ParentId == dst.ParentId)
+
+	mapDst := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("id,location"), src, mapDst,
+		fieldmask_utils.WithOpaqueTypes(reflect.TypeOf(location{})))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": src.Id, "location": src.Location}, mapDst)
+}
+
+func TestStructToStructWithRequireFullCoverage(t *testing.T) {
+	type Image struct {
+		OriginalUrl string `json:"original_url"`
+		ResizedUrl  string `json:"resized_url"`
+	}
+	type ImageV2 struct {
+		OriginalUrl string `json:"original_url"`
+		ResizedUrl  string `json:"resized_url"`
+		Thumbnail   string `json:"thumbnail"`
+	}
+	mask := fieldmask_utils.MaskFromString("original_url,resized_url")
+
+	err := fieldmask_utils.StructToStruct(mask, &Image{OriginalUrl: "original.jpg"}, &Image{},
+		fieldmask_utils.WithRequireFullCoverage())
+	require.NoError(t, err)
+
+	// A field has been added to the schema, but not to the mask.
+	err = fieldmask_utils.StructToStruct(mask, &ImageV2{OriginalUrl: "original.jpg"}, &ImageV2{},
+		fieldmask_utils.WithRequireFullCoverage())
+	require.Error(t, err)
+	assert.Equal(t, "fields thumbnail are not covered by the filter", err.Error())
+
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("id,avatar{original_url}"), testUserFull,
+		make(map[string]interface{}), fieldmask_utils.WithRequireFullCoverage())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "avatar.resized_url")
+}
+
+func TestFieldMaskFieldIsCopiedAsLeaf(t *testing.T) {
+	src := &testproto.UpdateUserRequest{
+		User:      &testproto.User{Id: 1, Username: "username"},
+		FieldMask: &field_mask.FieldMask{Paths: []string{"username", "avatar.original_url"}},
+	}
+	mask := fieldmask_utils.MaskFromString("user{id},field_mask")
+
+	dst := &testproto.UpdateUserRequest{}
+	err := fieldmask_utils.StructToStruct(mask, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{Id: 1}, dst.User)
+	assert.Equal(t, src.FieldMask.Paths, dst.FieldMask.Paths)
+	assert.False(t, src.FieldMask == dst.FieldMask)
+
+	dstMap := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, src, dstMap)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"user":       map[string]interface{}{"id": uint32(1)},
+		"field_mask": src.FieldMask,
+	}, dstMap)
+}
+
+func TestStructToStructWithStringTransform(t *testing.T) {
+	src := &testproto.User{
+		Id:       1,
+		Username: "  username ",
+		Tags:     []string{" tag1", "tag2  "},
+		Avatar:   &testproto.Image{OriginalUrl: " original.jpg"},
+		Name:     &testproto.User_MaleName{MaleName: "John "},
+	}
+	mask := fieldmask_utils.MaskFromString("id,username,tags,avatar,name")
+
+	dst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(mask, src, dst, fieldmask_utils.WithStringTransform(strings.TrimSpace))
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:       1,
+		Username: "username",
+		Tags:     []string{"tag1", "tag2"},
+		Avatar:   &testproto.Image{OriginalUrl: "original.jpg"},
+		Name:     &testproto.User_MaleName{MaleName: "John"},
+	}, dst)
+	// src is not modified.
+	assert.Equal(t, []string{" tag1", "tag2  "}, src.Tags)
+
+	dstMap := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, src, dstMap, fieldmask_utils.WithStringTransform(strings.TrimSpace))
+	require.NoError(t, err)
+	assert.Equal(t, "username", dstMap["username"])
+	assert.Equal(t, []string{"tag1", "tag2"}, dstMap["tags"])
+	assert.Equal(t, "original.jpg", dstMap["avatar"].(map[string]interface{})["original_url"])
+}
+
+func TestStructSliceToStructSlice(t *testing.T) {
+	type UserSummary struct {
+		Id       uint32           `json:"id"`
+		Username string           `json:"username"`
+		Avatar   *testproto.Image `json:"avatar"`
+	}
+	src := []*testproto.User{testUserFull, nil, testUserPartial}
+	mask := fieldmask_utils.MaskFromString("id,username,avatar{original_url}")
+
+	var dst []*UserSummary
+	err := fieldmask_utils.StructSliceToStructSlice(mask, src, &dst)
+	require.NoError(t, err)
+	assert.Equal(t, []*UserSummary{
+		{Id: 1, Username: "username", Avatar: &testproto.Image{OriginalUrl: "original.jpg"}},
+		nil,
+		{Id: 1, Username: "username"},
+	}, dst)
+
+	var values []UserSummary
+	err = fieldmask_utils.StructSliceToStructSlice(mask, src[:1], &values)
+	require.NoError(t, err)
+	assert.Equal(t, []UserSummary{{Id: 1, Username: "username", Avatar: &testproto.Image{OriginalUrl: "original.jpg"}}},
+		values)
+
+	err = fieldmask_utils.StructSliceToStructSlice(mask, []*testproto.User(nil), &dst)
+	require.NoError(t, err)
+	assert.Nil(t, dst)
+
+	err = fieldmask_utils.StructSliceToStructSlice(mask, src, dst)
+	assert.Error(t, err)
+	err = fieldmask_utils.StructSliceToStructSlice(mask, testUserFull, &dst)
+	assert.Error(t, err)
+}
+
+func TestStructToStructDstByValue(t *testing.T) {
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id"), testUserFull, testproto.User{})
+	require.Error(t, err)
+	assert.Equal(t, "dst must be a non-nil pointer to a struct, got testproto.User: was dst passed by value?",
+		err.Error())
+
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id"), testUserFull, (*testproto.User)(nil))
+	assert.Error(t, err)
+}
+
+func TestStructToStructWithDefaults(t *testing.T) {
+	defaults := fieldmask_utils.WithDefaults(map[string]interface{}{
+		"username":            "anonymous",
+		"role":                testproto.Role_REGULAR,
+		"id":                  100, // converted to uint32
+		"avatar":              &testproto.Image{OriginalUrl: "default.jpg"},
+		"avatar.original_url": "default.jpg",
+	})
+	mask := fieldmask_utils.MaskFromString("id,username,role,avatar")
+
+	// The defaults are only applied to zero values.
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, userDst, defaults)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:       testUserFull.Id,
+		Username: testUserFull.Username,
+		Role:     testUserFull.Role,
+		Avatar:   testUserFull.Avatar,
+	}, userDst)
+
+	userDst = &testproto.User{}
+	src := &testproto.User{Avatar: &testproto.Image{ResizedUrl: "resized.jpg"}}
+	err = fieldmask_utils.StructToStruct(mask, src, userDst, defaults)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:       100,
+		Username: "anonymous",
+		Role:     testproto.Role_REGULAR,
+		Avatar:   &testproto.Image{OriginalUrl: "default.jpg", ResizedUrl: "resized.jpg"},
+	}, userDst)
+
+	dstMap := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("username,avatar{original_url}"),
+		&testproto.User{}, dstMap, defaults)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"username": "anonymous",
+		"avatar":   map[string]interface{}{"original_url": "default.jpg"},
+	}, dstMap)
+
+	err = fieldmask_utils.StructToStruct(mask, &testproto.User{}, &testproto.User{},
+		fieldmask_utils.WithDefaults(map[string]interface{}{"username": 1.5}))
+	assert.Error(t, err)
+
+	// An int is not converted to a string holding the rune with that code point.
+	err = fieldmask_utils.StructToStruct(mask, &testproto.User{}, &testproto.User{},
+		fieldmask_utils.WithDefaults(map[string]interface{}{"username": 65}))
+	assert.Error(t, err)
+}
+
+func TestStructToStructRecursiveWildcard(t *testing.T) {
+	mask, err := fieldmask_utils.ParseMask("id,friends{**}")
+	require.NoError(t, err)
+	userDst := &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, testUserFull, userDst))
+	assert.Equal(t, &testproto.User{Id: testUserFull.Id, Friends: testUserFull.Friends}, userDst)
+
+	// The explicit siblings of the wildcard keep their sub masks.
+	mask, err = fieldmask_utils.ParseMask("friends{images{original_url},**}")
+	require.NoError(t, err)
+	userDst = &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, testUserFull, userDst))
+	require.Len(t, userDst.Friends, 1)
+	friend := testUserFull.Friends[0]
+	assert.Equal(t, friend.Username, userDst.Friends[0].Username)
+	assert.Equal(t, friend.Avatar, userDst.Friends[0].Avatar)
+	assert.Equal(t, friend.Tags, userDst.Friends[0].Tags)
+	assert.Equal(t, []*testproto.Image{
+		{OriginalUrl: friend.Images[0].OriginalUrl},
+		{OriginalUrl: friend.Images[1].OriginalUrl},
+	}, userDst.Friends[0].Images)
+
+	dstMap := make(map[string]interface{})
+	require.NoError(t, fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("**"), testUserPartial, dstMap))
+	assert.Equal(t, testUserPartial.Username, dstMap["username"])
+	assert.NotContains(t, dstMap, "XXX_sizecache")
+}
+
+func TestStructToStructWithStopPaths(t *testing.T) {
+	stop := fieldmask_utils.WithStopPaths("avatar", "friends.images")
+	mask := fieldmask_utils.MaskFromString("id,avatar{original_url},friends{id,images{original_url}}")
+
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, userDst, stop)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{
+		Id:      testUserFull.Id,
+		Friends: []*testproto.User{{Id: testUserFull.Friends[0].Id}},
+	}, userDst)
+
+	// An empty mask selects everything, but the stop paths.
+	dstMap := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, testUserFull, dstMap, stop)
+	require.NoError(t, err)
+	assert.NotContains(t, dstMap, "avatar")
+	assert.Contains(t, dstMap, "images")
+	require.Len(t, dstMap["friends"], 1)
+	friend := dstMap["friends"].([]map[string]interface{})[0]
+	assert.NotContains(t, friend, "images")
+	assert.Contains(t, friend, "avatar")
+
+	var buf bytes.Buffer
+	require.NoError(t, fieldmask_utils.StructToJSONStream(fieldmask_utils.Mask{}, testUserFull, &buf, stop))
+	expected, err := json.Marshal(dstMap)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+}
+
+func TestStructToMapWithNonFiniteFloatStrings(t *testing.T) {
+	type Measurement struct {
+		Value   float64   `json:"value"`
+		Min     *float32  `json:"min"`
+		Max     float64   `json:"max"`
+		Samples []float64 `json:"samples"`
+		Weights []float64 `json:"weights"`
+	}
+	lowest := float32(math.Inf(-1))
+	src := &Measurement{
+		Value:   math.NaN(),
+		Min:     &lowest,
+		Max:     math.Inf(1),
+		Samples: []float64{1, math.NaN()},
+		Weights: []float64{0.5},
+	}
+
+	dst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, src, dst, fieldmask_utils.WithNonFiniteFloatStrings())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"value":   "NaN",
+		"min":     "-Infinity",
+		"max":     "Infinity",
+		"samples": []interface{}{float64(1), "NaN"},
+		"weights": []float64{0.5},
+	}, dst)
+	_, err = json.Marshal(dst)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = fieldmask_utils.StructToJSONStream(fieldmask_utils.Mask{}, src, &buf, fieldmask_utils.WithNonFiniteFloatStrings())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":"NaN","min":"-Infinity","max":"Infinity","samples":[1,"NaN"],"weights":[0.5]}`,
+		buf.String())
+
+	// json.Marshal fails on the default representation.
+	dst = make(map[string]interface{})
+	require.NoError(t, fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, src, dst))
+	_, err = json.Marshal(dst)
+	assert.Error(t, err)
+}
+
+// record is a dynamic dst that implements fieldmask_utils.FieldSetter.
+type record map[string]interface{}
+
+func (r record) SetField(name string, value interface{}) error {
+	if name == "deactivated" {
+		return fmt.Errorf("field %s is read-only", name)
+	}
+	r[name] = value
+	return nil
+}
+
+func TestStructToStructFieldSetter(t *testing.T) {
+	dst := make(record)
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id,username,tags,avatar{original_url}"),
+		testUserFull, dst)
+	require.NoError(t, err)
+	assert.Equal(t, record{
+		"id":       testUserFull.Id,
+		"username": testUserFull.Username,
+		"tags":     testUserFull.Tags,
+		"avatar":   &testproto.Image{OriginalUrl: testUserFull.Avatar.OriginalUrl},
+	}, dst)
+
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("deactivated"), testUserFull, dst)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field deactivated is read-only")
+}
+
+func TestStructToStructWithScalarToSlice(t *testing.T) {
+	type Gallery struct {
+		Avatar    []*testproto.Image `json:"avatar"`
+		Usernames []string           `json:"username"`
+	}
+	mask := fieldmask_utils.MaskFromString("avatar{original_url},username")
+
+	dst := &Gallery{}
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, dst, fieldmask_utils.WithScalarToSlice())
+	require.NoError(t, err)
+	assert.Equal(t, &Gallery{
+		Avatar:    []*testproto.Image{{OriginalUrl: testUserFull.Avatar.OriginalUrl}},
+		Usernames: []string{testUserFull.Username},
+	}, dst)
+
+	dst = &Gallery{Avatar: []*testproto.Image{{}}}
+	err = fieldmask_utils.StructToStruct(mask, testUserPartial, dst, fieldmask_utils.WithScalarToSlice())
+	require.NoError(t, err)
+	assert.Nil(t, dst.Avatar)
+
+	err = fieldmask_utils.StructToStruct(mask, testUserFull, &Gallery{})
+	assert.Error(t, err)
+}
+
+func TestStructToStructWithSliceToScalar(t *testing.T) {
+	type User struct {
+		Images *testproto.Image `json:"images"`
+		Tags   string           `json:"tags"`
+	}
+	mask := fieldmask_utils.MaskFromString("images{resized_url},tags")
+
+	dst := &User{}
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, dst, fieldmask_utils.WithSliceToScalar())
+	require.NoError(t, err)
+	assert.Equal(t, &User{
+		Images: &testproto.Image{ResizedUrl: testUserFull.Images[0].ResizedUrl},
+		Tags:   testUserFull.Tags[0],
+	}, dst)
+
+	dst = &User{Images: &testproto.Image{}, Tags: "stale"}
+	err = fieldmask_utils.StructToStruct(mask, testUserPartial, dst, fieldmask_utils.WithSliceToScalar())
+	require.NoError(t, err)
+	assert.Equal(t, &User{}, dst)
+
+	err = fieldmask_utils.StructToStruct(mask, testUserFull, &User{})
+	assert.Error(t, err)
+}
+
+func TestCopyScalarMapWithKeyAllowlist(t *testing.T) {
+	src := &testproto.User{Meta: map[string]string{"foo": "bar", "baz": "qux"}}
+	mask := fieldmask_utils.MaskFromString("meta{foo}")
+
+	userDst := &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, src, userDst))
+	assert.Equal(t, map[string]string{"foo": "bar"}, userDst.Meta)
+	assert.Len(t, src.Meta, 2)
+
+	dstMap := make(map[string]interface{})
+	require.NoError(t, fieldmask_utils.StructToMap(mask, src, dstMap))
+	assert.Equal(t, map[string]interface{}{"meta": map[string]string{"foo": "bar"}}, dstMap)
+
+	dstMap = make(map[string]interface{})
+	require.NoError(t, fieldmask_utils.StructToMap(mask, src, dstMap, fieldmask_utils.WithSortedMapEntries()))
+	assert.Equal(t, map[string]interface{}{"meta": []fieldmask_utils.KeyValue{{Key: "foo", Value: "bar"}}}, dstMap)
+
+	// The inverse masks exclude the keys.
+	userDst = &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(fieldmask_utils.NewMaskInverse("meta.foo"), src, userDst))
+	assert.Equal(t, map[string]string{"baz": "qux"}, userDst.Meta)
+
+	// A mask selecting the whole map copies all the keys.
+	userDst = &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("meta"), src, userDst))
+	assert.Equal(t, src.Meta, userDst.Meta)
+}
+
+func TestStructToStructWithNoAlias(t *testing.T) {
+	// The slices of scalars are copied as is and share the backing array with src.
+	mask := fieldmask_utils.MaskFromString("username,tags")
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, &testproto.User{}, fieldmask_utils.WithNoAlias())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tags")
+
+	dst := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, testUserFull, dst, fieldmask_utils.WithNoAlias())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tags")
+
+	// The messages are copied field by field.
+	mask = fieldmask_utils.MaskFromString("username,avatar,images{original_url}")
+	userDst := &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, testUserFull, userDst, fieldmask_utils.WithNoAlias()))
+	assert.Equal(t, testUserFull.Username, userDst.Username)
+	assert.Equal(t, testUserFull.Avatar, userDst.Avatar)
+
+	// The slices sharing a part of a src backing array are reported too.
+	userDst = &testproto.User{Tags: testUserFull.Tags[1:]}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("username"), testUserFull, userDst,
+		fieldmask_utils.WithNoAlias())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dst fields tags share")
+}
+
+func TestStructToStructDynamicDst(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("username,avatar{original_url}")
+
+	var dst interface{} = &testproto.User{Id: 1}
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, testUserFull, dst))
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, testUserFull, &dst))
+	assert.Equal(t, &testproto.User{
+		Id:       1,
+		Username: testUserFull.Username,
+		Avatar:   &testproto.Image{OriginalUrl: testUserFull.Avatar.OriginalUrl},
+	}, dst)
+
+	var empty interface{}
+	assert.Error(t, fieldmask_utils.StructToStruct(mask, testUserFull, &empty))
+}
+
+func TestStructToMapWithPresenceMap(t *testing.T) {
+	type Settings struct {
+		Nickname *string          `json:"nickname"`
+		Age      *int32           `json:"age"`
+		Avatar   *testproto.Image `json:"avatar"`
+		Name     interface{}      `json:"name"`
+		Enabled  bool             `json:"enabled"`
+	}
+	age := int32(0)
+	src := &Settings{Age: &age}
+
+	dst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, src, dst, fieldmask_utils.WithPresenceMap())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"age": int32(0), "enabled": false}, dst)
+
+	// The absent fields are emitted as nil without the option.
+	dst = make(map[string]interface{})
+	require.NoError(t, fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, src, dst))
+	assert.Equal(t, map[string]interface{}{
+		"nickname": nil, "age": int32(0), "avatar": nil, "name": nil, "enabled": false,
+	}, dst)
+
+	dst = make(map[string]interface{})
+	mask := fieldmask_utils.MaskFromString("avatar{original_url},name,username")
+	err = fieldmask_utils.StructToMap(mask, testUserPartial, dst, fieldmask_utils.WithPresenceMap(),
+		fieldmask_utils.WithNilShape())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"username": testUserPartial.Username}, dst)
+}
+
+func TestStructToStructWithProtoCloneForFullSubtrees(t *testing.T) {
+	src := proto.Clone(testUserFull).(*testproto.User)
+	src.Avatar.XXX_unrecognized = []byte{0x78, 0x01}
+
+	mask := fieldmask_utils.MaskFromString("username,avatar,images,friends{id}")
+	expected := &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, src, expected))
+
+	dst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(mask, src, dst, fieldmask_utils.WithProtoCloneForFullSubtrees())
+	require.NoError(t, err)
+	// The unknown fields are only preserved by proto.Clone.
+	assert.Equal(t, src.Avatar.XXX_unrecognized, dst.Avatar.XXX_unrecognized)
+	dst.Avatar.XXX_unrecognized = nil
+	assert.Equal(t, expected, dst)
+
+	// The clones do not share the memory with src.
+	assert.False(t, src.Avatar == dst.Avatar)
+	assert.False(t, src.Images[0] == dst.Images[0])
+}
+
+func TestStructToMapWithOmitProtoDefaults(t *testing.T) {
+	dst := make(map[string]interface{})
+	err := fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, testUserPartial, dst,
+		fieldmask_utils.WithOmitProtoDefaults())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": testUserPartial.Id, "username": testUserPartial.Username}, dst)
+
+	// The oneof variants and the set optional fields are emitted even if they hold zero values.
+	type Settings struct {
+		Nickname *string `protobuf:"bytes,1,opt,name=nickname,proto3,oneof" json:"nickname,omitempty"`
+		Theme    string  `protobuf:"bytes,2,opt,name=theme,proto3" json:"theme,omitempty"`
+	}
+	nickname := ""
+	dst = make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(fieldmask_utils.Mask{}, &Settings{Nickname: &nickname}, dst,
+		fieldmask_utils.WithOmitProtoDefaults())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"nickname": ""}, dst)
+
+	dst = make(map[string]interface{})
+	src := &testproto.User{Name: &testproto.User_MaleName{}, Avatar: &testproto.Image{}}
+	err = fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("name,avatar,tags"), src, dst,
+		fieldmask_utils.WithOmitProtoDefaults())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":   map[string]interface{}{"male_name": ""},
+		"avatar": map[string]interface{}{},
+	}, dst)
+}
+
+func TestStructToStructWithSrcAndDstNaming(t *testing.T) {
+	type SrcImage struct {
+		OriginalUrl string
+		ResizedUrl  string
+	}
+	type SrcProfile struct {
+		DisplayName string
+		Avatar      *SrcImage
+	}
+	type DstImage struct {
+		OriginalUrl string `json:"original_url"`
+		ResizedUrl  string `json:"resized_url"`
+	}
+	type DstProfile struct {
+		DisplayName string    `json:"display_name"`
+		Avatar      *DstImage `json:"avatar"`
+	}
+	lowerFirst := func(name string) string { return strings.ToLower(name[:1]) + name[1:] }
+	snakeToCamel := func(name string) string {
+		parts := strings.Split(name, "_")
+		for i := 1; i < len(parts); i++ {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+		return strings.Join(parts, "")
+	}
+	src := &SrcProfile{DisplayName: "John", Avatar: &SrcImage{OriginalUrl: "original.jpg", ResizedUrl: "resized.jpg"}}
+	mask := fieldmask_utils.MaskFromString("displayName,avatar{originalUrl}")
+
+	dst := &DstProfile{}
+	err := fieldmask_utils.StructToStruct(mask, src, dst,
+		fieldmask_utils.WithSrcNaming(lowerFirst), fieldmask_utils.WithDstNaming(snakeToCamel))
+	require.NoError(t, err)
+	assert.Equal(t, &DstProfile{DisplayName: "John", Avatar: &DstImage{OriginalUrl: "original.jpg"}}, dst)
+
+	// The names do not match without the dst naming.
+	err = fieldmask_utils.StructToStruct(mask, src, &DstProfile{}, fieldmask_utils.WithSrcNaming(lowerFirst))
+	assert.Error(t, err)
+
+	m := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, src, m, fieldmask_utils.WithSrcNaming(lowerFirst))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"displayName": "John",
+		"avatar":      map[string]interface{}{"originalUrl": "original.jpg"},
+	}, m)
+}
+
+// gogoUser simulates a subset of testproto.User generated by another generator: the oneof wrappers are distinct
+// types implementing a distinct interface.
+type gogoUser struct {
+	Id   uint32         `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name isGogoUserName `protobuf_oneof:"name"`
+}
+
+type isGogoUserName interface {
+	isGogoUserName()
+}
+
+type gogoUserMaleName struct {
+	MaleName string `protobuf:"bytes,7,opt,name=male_name,json=maleName,proto3,oneof"`
+}
+
+type gogoUserFemaleName struct {
+	FemaleName string `protobuf:"bytes,8,opt,name=female_name,json=femaleName,proto3,oneof"`
+}
+
+type gogoUserProfile struct {
+	Profile *testproto.Profile `protobuf:"bytes,14,opt,name=profile,proto3,oneof"`
+}
+
+func (*gogoUserMaleName) isGogoUserName()   {}
+func (*gogoUserFemaleName) isGogoUserName() {}
+func (*gogoUserProfile) isGogoUserName()    {}
+
+func TestStructToStructWithOneofWrappers(t *testing.T) {
+	wrappers := fieldmask_utils.WithOneofWrappers(
+		(*gogoUserMaleName)(nil), (*gogoUserFemaleName)(nil), (*gogoUserProfile)(nil))
+	mask := fieldmask_utils.MaskFromString("id,name")
+
+	dst := &gogoUser{}
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, testUserFull, dst, wrappers))
+	assert.Equal(t, &gogoUser{Id: testUserFull.Id, Name: &gogoUserMaleName{MaleName: "John"}}, dst)
+
+	src := &testproto.User{Name: &testproto.User_Profile{Profile: &testproto.Profile{
+		DisplayName: "John",
+		Avatar:      &testproto.Image{OriginalUrl: "original.jpg"},
+	}}}
+	dst = &gogoUser{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("name{profile{display_name}}"), src, dst,
+		wrappers)
+	require.NoError(t, err)
+	assert.Equal(t, &gogoUser{Name: &gogoUserProfile{Profile: &testproto.Profile{DisplayName: "John"}}}, dst)
+
+	// The wrappers are required to resolve the dst variant.
+	err = fieldmask_utils.StructToStruct(mask, testUserFull, &gogoUser{})
+	assert.Error(t, err)
+	err = fieldmask_utils.StructToStruct(mask, testUserFull, &gogoUser{},
+		fieldmask_utils.WithOneofWrappers((*gogoUserFemaleName)(nil)))
+	assert.Error(t, err)
+}
+
+func TestCopyWithCyclicMask(t *testing.T) {
+	mask := fieldmask_utils.Mask{"id": fieldmask_utils.Mask{}}
+	mask["friends"] = mask
+
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, &testproto.User{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "friends")
+
+	err = fieldmask_utils.StructToMap(mask, testUserFull, make(map[string]interface{}))
+	assert.Error(t, err)
+
+	inverse := fieldmask_utils.MaskInverse{}
+	inverse["avatar"] = fieldmask_utils.MaskInverse{"original_url": inverse}
+	err = fieldmask_utils.StructToStruct(inverse, testUserFull, &testproto.User{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "avatar.original_url")
+
+	// The same sub mask may be used by several fields.
+	shared := fieldmask_utils.Mask{"original_url": fieldmask_utils.Mask{}}
+	userDst := &testproto.User{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{"avatar": shared, "images": shared}, testUserFull, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, testUserFull.Avatar.OriginalUrl, userDst.Avatar.OriginalUrl)
+}
@@ -0,0 +1,19 @@
+package fieldmask_utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MultiError is an error that holds all the errors that occurred during a best effort copy.
+type MultiError struct {
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(e.Errors), strings.Join(messages, "; "))
+}
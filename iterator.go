@@ -0,0 +1,105 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StructFieldIterator returns a function that lazily yields the elements of the repeated field found at the dotted
+// `path` in `src` (e.g. "friends" or "avatar.tags"), each converted to a map the same way StructToMap does it.
+// `filter` is applied at the root of `src`: the elements are filtered with the sub filter found at `path`. The
+// iteration is empty if `path` or any of its prefixes is a WithStopPaths path.
+// The returned function returns false once all the elements have been yielded. The nil elements are yielded as nil
+// maps. Since the function can not return an error the iteration also stops if an element fails to be copied: use
+// WithIteratorError to tell a complete iteration from a truncated one.
+func StructFieldIterator(
+	filter FieldFilter,
+	src interface{},
+	path string,
+	opts ...interface{},
+) (func() (map[string]interface{}, bool), error) {
+	o := newOptions(opts)
+	filter = o.rootFilter(filter)
+	if err := cycleError(filter); err != nil {
+		return nil, err
+	}
+	val := reflect.ValueOf(src)
+
+	fieldPath := ""
+	for _, fieldName := range strings.Split(path, ".") {
+		fieldPath = joinPath(fieldPath, fieldName)
+		if o.stopPaths != nil && o.stopPaths[fieldPath] {
+			// The field is never copied, the same way StructToMap skips it.
+			return emptyIterator, nil
+		}
+		val = indirect(val)
+		if !val.IsValid() {
+			// A nil message on the path: there is nothing to iterate over.
+			return emptyIterator, nil
+		}
+		if val.Kind() != reflect.Struct {
+			return nil, errors.Errorf("field %s in path %s is not a message", fieldName, path)
+		}
+
+		goFieldName, ok := o.fieldMapping(val, true)[fieldName]
+		if !ok {
+			return nil, errors.Errorf("no such field: %s in path %s", fieldName, path)
+		}
+		subFilter, ok := filter.Filter(fieldName)
+		if !ok {
+			return nil, errors.Errorf("field %s in path %s is not selected by the filter", fieldName, path)
+		}
+		filter = subFilter
+		val = val.FieldByName(goFieldName)
+	}
+
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return nil, errors.Errorf("field %s is not a repeated field", path)
+	}
+	elemType := val.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, errors.Errorf("field %s is not a repeated message field", path)
+	}
+
+	i := 0
+	return func() (map[string]interface{}, bool) {
+		if i >= val.Len() {
+			return nil, false
+		}
+		elem := val.Index(i)
+		i++
+		if elem.Kind() == reflect.Ptr && elem.IsNil() {
+			return nil, true
+		}
+		m := make(map[string]interface{})
+		if err := structToMap(filter, elem.Interface(), m, path, o); err != nil {
+			err = errors.Wrapf(err, "failed to copy the element %d of %s", i-1, path)
+			if o.logger != nil {
+				o.logger("%v", err)
+			}
+			if o.iteratorErr != nil {
+				*o.iteratorErr = err
+			}
+			i = val.Len()
+			return nil, false
+		}
+		return m, true
+	}, nil
+}
+
+// WithIteratorError makes the function returned by StructFieldIterator store the error that stopped the iteration
+// in `target`. `target` is left untouched if all the elements have been yielded.
+func WithIteratorError(target *error) Option {
+	return func(o *options) {
+		o.iteratorErr = target
+	}
+}
+
+func emptyIterator() (map[string]interface{}, bool) {
+	return nil, false
+}
@@ -0,0 +1,140 @@
+package fieldmask_utils_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructFieldIterator(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,images{resized_url}")
+	next, err := fieldmask_utils.StructFieldIterator(mask, testUserFull, "images")
+	require.NoError(t, err)
+
+	var items []map[string]interface{}
+	for item, ok := next(); ok; item, ok = next() {
+		items = append(items, item)
+	}
+	assert.Equal(t, []map[string]interface{}{
+		{"resized_url": testUserFull.Images[0].ResizedUrl},
+		{"resized_url": testUserFull.Images[1].ResizedUrl},
+	}, items)
+
+	// The iterator is exhausted.
+	_, ok := next()
+	assert.False(t, ok)
+}
+
+func TestStructFieldIteratorEmptyMask(t *testing.T) {
+	next, err := fieldmask_utils.StructFieldIterator(fieldmask_utils.Mask{}, testUserFull, "friends")
+	require.NoError(t, err)
+
+	item, ok := next()
+	require.True(t, ok)
+	assert.Equal(t, testUserFull.Friends[0].Username, item["username"])
+	_, ok = next()
+	assert.False(t, ok)
+}
+
+func TestStructFieldIteratorNilParent(t *testing.T) {
+	type Album struct {
+		Images []*testproto.Image `json:"images"`
+	}
+	type Profile struct {
+		Album *Album `json:"album"`
+	}
+	next, err := fieldmask_utils.StructFieldIterator(fieldmask_utils.Mask{}, &Profile{}, "album.images")
+	require.NoError(t, err)
+	_, ok := next()
+	assert.False(t, ok)
+}
+
+func TestStructFieldIteratorWithStopPaths(t *testing.T) {
+	type Album struct {
+		Images []*testproto.Image `json:"images"`
+	}
+	type Profile struct {
+		Album *Album `json:"album"`
+	}
+	src := &Profile{Album: &Album{Images: []*testproto.Image{{OriginalUrl: "original.jpg"}}}}
+
+	// Neither the field nor its parents are iterated over.
+	for _, stopPath := range []string{"album", "album.images"} {
+		next, err := fieldmask_utils.StructFieldIterator(fieldmask_utils.Mask{}, src, "album.images",
+			fieldmask_utils.WithStopPaths(stopPath))
+		require.NoError(t, err, stopPath)
+		_, ok := next()
+		assert.False(t, ok, stopPath)
+	}
+
+	// The stop paths under the elements are applied to the elements.
+	next, err := fieldmask_utils.StructFieldIterator(fieldmask_utils.Mask{}, testUserFull, "friends",
+		fieldmask_utils.WithStopPaths("friends.username"))
+	require.NoError(t, err)
+	item, ok := next()
+	require.True(t, ok)
+	assert.NotContains(t, item, "username")
+}
+
+func TestStructFieldIteratorFail(t *testing.T) {
+	testCases := []struct {
+		mask fieldmask_utils.Mask
+		path string
+	}{
+		{fieldmask_utils.Mask{}, "unknown"},
+		{fieldmask_utils.Mask{}, "tags"},
+		{fieldmask_utils.Mask{}, "id"},
+		{fieldmask_utils.Mask{}, "id.foo"},
+		{fieldmask_utils.MaskFromString("id"), "images"},
+	}
+	for _, testCase := range testCases {
+		_, err := fieldmask_utils.StructFieldIterator(testCase.mask, testUserFull, testCase.path)
+		assert.Error(t, err, testCase.path)
+	}
+}
+
+func TestStructFieldIteratorWithCyclicMask(t *testing.T) {
+	mask := fieldmask_utils.Mask{"id": fieldmask_utils.Mask{}}
+	mask["friends"] = mask
+	_, err := fieldmask_utils.StructFieldIterator(mask, testUserFull, "friends")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cyclic")
+}
+
+func TestStructFieldIteratorElementError(t *testing.T) {
+	type Item struct {
+		Name string `json:"name"`
+	}
+	type List struct {
+		Items []*Item `json:"items"`
+	}
+	src := &List{Items: []*Item{{Name: "a"}, {}, {Name: "c"}}}
+	var logged []string
+	var iterErr error
+	next, err := fieldmask_utils.StructFieldIterator(fieldmask_utils.Mask{}, src, "items",
+		fieldmask_utils.WithDefaults(map[string]interface{}{"items.name": 1.5}),
+		fieldmask_utils.WithIteratorError(&iterErr),
+		fieldmask_utils.WithLogger(func(format string, args ...interface{}) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}))
+	require.NoError(t, err)
+
+	item, ok := next()
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"name": "a"}, item)
+	require.NoError(t, iterErr)
+
+	// The second element fails: the iteration stops and the error is reported.
+	_, ok = next()
+	assert.False(t, ok)
+	require.Error(t, iterErr)
+	assert.Contains(t, iterErr.Error(), "element 1 of items")
+	assert.Contains(t, strings.Join(logged, "\n"), "element 1 of items")
+	_, ok = next()
+	assert.False(t, ok)
+}
@@ -2,6 +2,9 @@ package fieldmask_utils
 
 import (
 	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/gogo/protobuf/types"
@@ -21,18 +24,30 @@ type Mask map[string]FieldFilter
 // Compile time interface check.
 var _ FieldFilter = Mask{}
 
+// emptyMask is returned by Filter instead of allocating a new empty Mask for every field.
+// It is a nil map, so any attempt to mutate it panics rather than silently changing the filter of other fields.
+var emptyMask Mask
+
+// recursiveWildcard is the Mask field name that selects all the fields of a level with all their descendants,
+// e.g. "a{**}" selects everything under `a`. The fields listed next to it keep their own sub masks:
+// "a{b{c},**}" selects all the fields of `a`, but only `c` of `a.b`.
+const recursiveWildcard = "**"
+
 // Filter returns true for those fieldNames that exist in the underlying map.
 // Field names that start with "XXX_" are ignored as unexported.
 func (m Mask) Filter(fieldName string) (FieldFilter, bool) {
 	if len(m) == 0 {
 		// If the mask is empty choose all the exported fields.
-		return Mask{}, !strings.HasPrefix(fieldName, "XXX_")
+		return emptyMask, !strings.HasPrefix(fieldName, "XXX_")
 	}
 	subFilter, ok := m[fieldName]
 	if !ok {
-		subFilter = Mask{}
+		if _, ok := m[recursiveWildcard]; ok {
+			return emptyMask, !strings.HasPrefix(fieldName, "XXX_")
+		}
+		return emptyMask, false
 	}
-	return subFilter, ok
+	return subFilter, true
 }
 
 func (m Mask) StructToMap(in interface{}) (map[string]interface{}, error) {
@@ -47,16 +62,44 @@ func (m Mask) StructToMap(in interface{}) (map[string]interface{}, error) {
 }
 
 func mapToString(m map[string]FieldFilter) string {
+	return mapToStringGuarded(m, make(map[uintptr]bool))
+}
+
+// mapToStringGuarded is mapToString that renders the sub masks referring to their `ancestors` as "{...}" instead of
+// recursing into them forever.
+func mapToStringGuarded(m map[string]FieldFilter, ancestors map[uintptr]bool) string {
 	if len(m) == 0 {
 		return ""
 	}
+	id := reflect.ValueOf(m).Pointer()
+	if ancestors[id] {
+		return "..."
+	}
+	ancestors[id] = true
+	defer delete(ancestors, id)
+
+	fieldNames := make([]string, 0, len(m))
+	for fieldName := range m {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	// Sort the field names to make the output deterministic.
+	sort.Strings(fieldNames)
+
 	var result []string
-	for fieldName, maskNode := range m {
+	for _, fieldName := range fieldNames {
+		maskNode := m[fieldName]
 		r := fieldName
 		var sub string
-		if stringer, ok := maskNode.(fmt.Stringer); ok {
-			sub = stringer.String()
-		} else {
+		switch maskNode := maskNode.(type) {
+		case nil:
+			// Leaf nodes of an inverse mask have no sub filter.
+		case Mask:
+			sub = mapToStringGuarded(maskNode, ancestors)
+		case MaskInverse:
+			sub = mapToStringGuarded(maskNode, ancestors)
+		case fmt.Stringer:
+			sub = maskNode.String()
+		default:
 			sub = fmt.Sprint(maskNode)
 		}
 		if sub != "" {
@@ -67,19 +110,297 @@ func mapToString(m map[string]FieldFilter) string {
 	return strings.Join(result, ",")
 }
 
+// filterCycle returns the field names, in reverse order, of a path of `filter` whose sub filter is one of its own
+// `ancestors`, e.g. ["a"] for m["a"] = m. Only the Mask and MaskInverse nodes are inspected.
+func filterCycle(filter FieldFilter, ancestors []uintptr) ([]string, bool) {
+	m, ok := filterMap(filter)
+	if !ok || len(m) == 0 {
+		return nil, false
+	}
+	id := reflect.ValueOf(m).Pointer()
+	for _, ancestor := range ancestors {
+		if ancestor == id {
+			return nil, true
+		}
+	}
+	ancestors = append(ancestors, id)
+	for fieldName, subFilter := range m {
+		if cycle, ok := filterCycle(subFilter, ancestors); ok {
+			return append(cycle, fieldName), true
+		}
+	}
+	return nil, false
+}
+
+// filterMap returns the nodes of the Mask and MaskInverse filters.
+func filterMap(filter FieldFilter) (map[string]FieldFilter, bool) {
+	switch filter := filter.(type) {
+	case Mask:
+		return filter, true
+	case MaskInverse:
+		return filter, true
+	}
+	return nil, false
+}
+
+// cyclicPath returns the field names, in order, of a path of `filter` whose sub filter is one of its own ancestors.
+func cyclicPath(filter FieldFilter) ([]string, bool) {
+	// The masks without nested sub masks, the most common ones, can not be cyclic: skip the walk.
+	m, _ := filterMap(filter)
+	nested := false
+	for _, subFilter := range m {
+		if subMap, ok := filterMap(subFilter); ok && len(subMap) > 0 {
+			nested = true
+			break
+		}
+	}
+	if !nested {
+		return nil, false
+	}
+
+	cycle, ok := filterCycle(filter, make([]uintptr, 0, 8))
+	if !ok {
+		return nil, false
+	}
+	for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+		cycle[i], cycle[j] = cycle[j], cycle[i]
+	}
+	return cycle, true
+}
+
+// cycleError returns an error if a sub filter of `filter` is one of its own ancestors, e.g. m["a"] = m.
+func cycleError(filter FieldFilter) error {
+	cycle, ok := cyclicPath(filter)
+	if !ok {
+		return nil
+	}
+	return errors.Errorf("the filter is cyclic: the sub filter of %s is one of its ancestors", strings.Join(cycle, "."))
+}
+
 func (m Mask) String() string {
 	return mapToString(m)
 }
 
+// Equal reports whether `other` is a Mask with the same tree structure.
+func (m Mask) Equal(other FieldFilter) bool {
+	return filtersEqual(m, other, nil)
+}
+
+// Count returns the number of leaf paths selected by the mask, e.g. 3 for "a,b{c,d}". A cyclic mask selects
+// infinitely many paths: its count is 0.
+func (m Mask) Count() int {
+	if _, cyclic := cyclicPath(m); cyclic {
+		return 0
+	}
+	return leafCount(m)
+}
+
+// Merge adds the given dotted paths (e.g. "email", "avatar.original_url") to the mask in place. Same as in
+// MaskFromProtoFieldMask, the larger scope wins: merging "a.b" into a mask that selects "a" entirely keeps "a",
+// merging "a" into a mask that selects "a.b" selects "a" entirely. Empty path segments are ignored. A cyclic mask
+// is left unchanged since its sub masks are shared between the levels.
+func (m Mask) Merge(paths ...string) {
+	if _, cyclic := cyclicPath(m); cyclic {
+		return
+	}
+	for _, path := range paths {
+		fieldNames := make([]string, 0, strings.Count(path, ".")+1)
+		for _, fieldName := range strings.Split(path, ".") {
+			if fieldName != "" {
+				fieldNames = append(fieldNames, fieldName)
+			}
+		}
+
+		mask := m
+		for i, fieldName := range fieldNames {
+			subMask, ok := mask[fieldName].(Mask)
+			if ok && len(subMask) == 0 {
+				// The field is already selected entirely.
+				break
+			}
+			if !ok || i == len(fieldNames)-1 {
+				subMask = make(Mask)
+				mask[fieldName] = subMask
+			}
+			mask = subMask
+		}
+	}
+}
+
+// Remove deletes the dotted path (e.g. "avatar.original_url") from the mask in place and returns whether it was
+// present. The parents left without sub fields are deleted as well, since an empty sub mask would select all the
+// fields: removing "avatar.original_url" from "id,avatar{original_url}" results in "id".
+func (m Mask) Remove(path string) bool {
+	var fieldNames []string
+	for _, fieldName := range strings.Split(path, ".") {
+		if fieldName != "" {
+			fieldNames = append(fieldNames, fieldName)
+		}
+	}
+	return len(fieldNames) > 0 && removePath(m, fieldNames)
+}
+
+// removePath deletes the path consisting of `fieldNames` from `m` pruning the parents left empty.
+func removePath(m Mask, fieldNames []string) bool {
+	subFilter, ok := m[fieldNames[0]]
+	if !ok {
+		return false
+	}
+	if len(fieldNames) > 1 {
+		subMask, ok := subFilter.(Mask)
+		if !ok || !removePath(subMask, fieldNames[1:]) {
+			return false
+		}
+		if len(subMask) > 0 {
+			return true
+		}
+	}
+	delete(m, fieldNames[0])
+	return true
+}
+
+// leafCount returns the number of leaf paths in the tree `m`. Sub filters that are neither a Mask nor
+// a MaskInverse count as a single leaf.
+func leafCount(m map[string]FieldFilter) int {
+	count := 0
+	for _, subFilter := range m {
+		switch subFilter := subFilter.(type) {
+		case Mask:
+			if len(subFilter) > 0 {
+				count += leafCount(subFilter)
+				continue
+			}
+		case MaskInverse:
+			if len(subFilter) > 0 {
+				count += leafCount(subFilter)
+				continue
+			}
+		}
+		count++
+	}
+	return count
+}
+
+// mapsEqual reports whether the trees `a` and `b` have the same structure. The pairs of nodes being compared are
+// kept in `comparing`: a pair met again below itself is part of a cycle present in both trees.
+func mapsEqual(a, b map[string]FieldFilter, comparing map[[2]uintptr]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 {
+		return true
+	}
+	pair := [2]uintptr{reflect.ValueOf(a).Pointer(), reflect.ValueOf(b).Pointer()}
+	if comparing[pair] {
+		return true
+	}
+	if comparing == nil {
+		comparing = make(map[[2]uintptr]bool)
+	}
+	comparing[pair] = true
+	defer delete(comparing, pair)
+
+	for fieldName, subFilter := range a {
+		otherSubFilter, ok := b[fieldName]
+		if !ok || !filtersEqual(subFilter, otherSubFilter, comparing) {
+			return false
+		}
+	}
+	return true
+}
+
+func filtersEqual(a, b FieldFilter, comparing map[[2]uintptr]bool) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case Mask:
+		otherMask, ok := b.(Mask)
+		return ok && mapsEqual(a, otherMask, comparing)
+	case MaskInverse:
+		otherMask, ok := b.(MaskInverse)
+		return ok && mapsEqual(a, otherMask, comparing)
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
 // MaskInverse is an inversed version of a Mask (will copy all the fields except those mentioned in the mask).
 type MaskInverse Mask
 
+// emptyMaskInverse is the MaskInverse counterpart of emptyMask.
+var emptyMaskInverse MaskInverse
+
+// NewMaskInverse creates a MaskInverse that excludes the given dotted paths (e.g. "id", "friends.username").
+// Note that an empty MaskInverse (no paths) selects all the fields, same as an empty Mask.
+// Empty path segments are ignored.
+func NewMaskInverse(paths ...string) MaskInverse {
+	root := make(MaskInverse)
+	for _, path := range paths {
+		var fieldNames []string
+		for _, fieldName := range strings.Split(path, ".") {
+			if fieldName != "" {
+				fieldNames = append(fieldNames, fieldName)
+			}
+		}
+		addInversePath(root, fieldNames)
+	}
+	return root
+}
+
+// MaskInverseFromString creates a MaskInverse from a comma separated list of dotted paths, e.g. "id,friends.username".
+// The last segment of a path may be the wildcard "*" that excludes all the sub fields (as well as the map entries) of
+// the field while keeping the field itself: "meta.*" results in an empty `meta` message or map in dst.
+func MaskInverseFromString(s string) MaskInverse {
+	paths := strings.Split(s, ",")
+	for i, path := range paths {
+		paths[i] = strings.TrimSpace(path)
+	}
+	return NewMaskInverse(paths...)
+}
+
+// wildcard is the MaskInverse field name that excludes all the fields.
+const wildcard = "*"
+
+// excludesAll reports whether `filter` is a MaskInverse that excludes all the fields with the wildcard.
+func excludesAll(filter FieldFilter) bool {
+	m, ok := filter.(MaskInverse)
+	if !ok {
+		return false
+	}
+	subFilter, ok := m[wildcard]
+	return ok && subFilter == nil
+}
+
+// addInversePath excludes the path consisting of `fieldNames` in the `root` MaskInverse.
+func addInversePath(root MaskInverse, fieldNames []string) {
+	mask := root
+	for i, fieldName := range fieldNames {
+		subNode, ok := mask[fieldName]
+		if ok && subNode == nil {
+			// The whole subtree is already excluded.
+			return
+		}
+		if i == len(fieldNames)-1 {
+			mask[fieldName] = nil
+			return
+		}
+		if !ok {
+			subNode = make(MaskInverse)
+			mask[fieldName] = subNode
+		}
+		mask = subNode.(MaskInverse)
+	}
+}
+
 // Filter returns true for those fieldNames that do NOT exist in the underlying map.
-// Field names that start with "XXX_" are ignored as unexported.
+// Field names that start with "XXX_" are ignored as unexported. The wildcard "*" excludes all the fields.
 func (m MaskInverse) Filter(fieldName string) (FieldFilter, bool) {
+	if subFilter, ok := m[wildcard]; ok && subFilter == nil {
+		return nil, false
+	}
 	subFilter, ok := m[fieldName]
 	if !ok {
-		return MaskInverse{}, !strings.HasPrefix(fieldName, "XXX_")
+		return emptyMaskInverse, !strings.HasPrefix(fieldName, "XXX_")
 	}
 	return subFilter, subFilter != nil
 }
@@ -99,9 +420,55 @@ func (m MaskInverse) String() string {
 	return mapToString(m)
 }
 
+// Count returns the number of leaf paths excluded by the mask, e.g. 3 for "a,b{c,d}". A cyclic mask excludes
+// infinitely many paths: its count is 0.
+func (m MaskInverse) Count() int {
+	if _, cyclic := cyclicPath(m); cyclic {
+		return 0
+	}
+	return leafCount(m)
+}
+
+// Equal reports whether `other` is a MaskInverse with the same tree structure.
+func (m MaskInverse) Equal(other FieldFilter) bool {
+	return filtersEqual(m, other, nil)
+}
+
+// FilterFunc is an adapter to allow the use of ordinary functions as FieldFilters.
+// The function returns the FieldFilter for the sub fields of the given field and whether the field is selected.
+type FilterFunc func(fieldName string) (FieldFilter, bool)
+
+// Compile time interface check.
+var _ FieldFilter = FilterFunc(nil)
+
+// Filter calls f(fieldName).
+func (f FilterFunc) Filter(fieldName string) (FieldFilter, bool) {
+	return f(fieldName)
+}
+
+func (f FilterFunc) StructToMap(in interface{}) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+
+	err := StructToMap(f, in, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 type (
 	Naming    func(string) string
 	Whitelist []string
+	// TrimPrefix is a prefix that is removed from the paths that have it, e.g. "user" turns "user.profile.name" to
+	// "profile.name". Paths without the prefix are used as is.
+	TrimPrefix string
+	// StrictTrimPrefix is like TrimPrefix, but the paths without the prefix are considered invalid.
+	StrictTrimPrefix string
+	// MaxDepth limits the number of nested messages AllPaths and MaskFromRegex descend into.
+	MaxDepth int
+	// MatchGoNames makes MaskFromRegex match the Go field names instead of the names resolved from the tags.
+	MatchGoNames bool
 )
 
 // MaskFromProtoFieldMask creates a Mask from the given FieldMask.
@@ -109,9 +476,70 @@ func MaskFromProtoFieldMask(
 	fm *types.FieldMask,
 	opts ...interface{},
 ) (Mask, error) {
+	paths, whitelist, err := fieldMaskPaths(fm, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	root := make(Mask)
+	for _, fieldNames := range paths {
+		mask := root
+		for _, fieldName := range fieldNames {
+			subNode, ok := mask[fieldName]
+			if !ok {
+				mask[fieldName] = make(Mask)
+				subNode = mask[fieldName]
+			}
+			mask = subNode.(Mask)
+		}
+	}
+
+	if len(whitelist) > 0 && len(root) == 0 {
+		// The whitelist paths are relative to the prefix, so they are not trimmed again. The other options,
+		// such as Naming, still apply.
+		fallbackOpts := make([]interface{}, 0, len(opts))
+		for _, opt := range opts {
+			switch opt.(type) {
+			case TrimPrefix, StrictTrimPrefix:
+				continue
+			}
+			fallbackOpts = append(fallbackOpts, opt)
+		}
+		return MaskFromProtoFieldMask(
+			&types.FieldMask{
+				Paths: whitelist,
+			},
+			fallbackOpts...,
+		)
+	}
+
+	return root, nil
+}
+
+// MaskInverseFromProtoFieldMask creates a MaskInverse that excludes the paths of the given FieldMask.
+// The paths are handled the same way as in MaskFromProtoFieldMask, so `opts` such as Naming and Whitelist are
+// supported.
+func MaskInverseFromProtoFieldMask(fm *types.FieldMask, opts ...interface{}) (MaskInverse, error) {
+	paths, _, err := fieldMaskPaths(fm, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	root := make(MaskInverse)
+	for _, fieldNames := range paths {
+		addInversePath(root, fieldNames)
+	}
+	return root, nil
+}
+
+// fieldMaskPaths splits the paths of the FieldMask to the field names applying the `opts`.
+// It also returns the whitelist found in `opts`.
+func fieldMaskPaths(fm *types.FieldMask, opts []interface{}) ([][]string, Whitelist, error) {
 	var (
-		naming    = func(name string) string { return name }
-		whitelist = []string{}
+		naming       = func(name string) string { return name }
+		whitelist    = Whitelist{}
+		trimPrefix   string
+		strictPrefix bool
 	)
 
 	for _, opt := range opts {
@@ -121,15 +549,25 @@ func MaskFromProtoFieldMask(
 
 		case Whitelist:
 			whitelist = opt
+
+		case TrimPrefix:
+			trimPrefix, strictPrefix = pathPrefix(string(opt)), false
+
+		case StrictTrimPrefix:
+			trimPrefix, strictPrefix = pathPrefix(string(opt)), true
 		}
 	}
 
-	root := make(Mask)
+	var paths [][]string
 	for _, path := range fm.GetPaths() {
-		var (
-			mask = root
-			skip = false
-		)
+		skip := false
+
+		if trimPrefix != "" {
+			if !strings.HasPrefix(path, trimPrefix) && strictPrefix {
+				return nil, nil, errors.Errorf("field %s does not start with %s", path, trimPrefix)
+			}
+			path = strings.TrimPrefix(path, trimPrefix)
+		}
 
 		if len(whitelist) > 0 {
 			skip = true
@@ -141,39 +579,200 @@ func MaskFromProtoFieldMask(
 		}
 
 		if skip {
-			return nil, errors.Errorf("field %s is not allowed in mask", path)
+			return nil, nil, errors.Errorf("field %s is not allowed in mask", path)
 		}
 
-		for _, fieldName := range strings.Split(path, ".") {
-			if fieldName == "" {
-				return nil, errors.Errorf("invalid fieldName FieldFilter format: \"%s\"", path)
+		segments, err := splitPath(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fieldNames := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			if segment.name == "" && !segment.quoted {
+				return nil, nil, errors.Errorf("invalid fieldName FieldFilter format: \"%s\"", path)
 			}
 
-			newFieldName := naming(fieldName)
-			subNode, ok := mask[newFieldName]
-			if !ok {
-				mask[newFieldName] = make(Mask)
-				subNode = mask[newFieldName]
+			newFieldName := segment.name
+			if !segment.quoted {
+				newFieldName = naming(segment.name)
 			}
-			mask = subNode.(Mask)
+			fieldNames = append(fieldNames, newFieldName)
+		}
+		paths = append(paths, fieldNames)
+	}
+	// Normalize the paths the mask is built from, i.e. after the prefixes are trimmed and the names are converted.
+	return normalizeSegments(paths), whitelist, nil
+}
+
+// NormalizePaths returns the minimal set of the dotted `paths` selecting the same fields: the duplicates and the paths
+// subsumed by an ancestor path are removed, e.g. ["a", "a.b", "a.b.c", "d"] results in ["a", "d"].
+// The segments enclosed in backticks are single field names, so "a.`b.c`" is not subsumed by "a.b".
+// The order of the remaining paths is preserved.
+func NormalizePaths(paths []string) []string {
+	segments := make([][]string, len(paths))
+	for i, path := range paths {
+		segments[i] = pathFieldNames(path)
+	}
+	keep := make(map[int]bool, len(paths))
+	for _, i := range normalizedIndexes(segments) {
+		keep[i] = true
+	}
+	result := make([]string, 0, len(keep))
+	for i, path := range paths {
+		if keep[i] {
+			result = append(result, path)
 		}
 	}
+	return result
+}
 
-	if len(whitelist) > 0 && len(root) == 0 {
-		return MaskFromProtoFieldMask(
-			&types.FieldMask{
-				Paths: whitelist,
-			},
-		)
+// pathFieldNames splits the dotted `path` into the field names the same way MaskFromProtoFieldMask does.
+// A path that can not be split is a single field name.
+func pathFieldNames(path string) []string {
+	segments, err := splitPath(path)
+	if err != nil {
+		return []string{path}
+	}
+	fieldNames := make([]string, len(segments))
+	for i, segment := range segments {
+		fieldNames[i] = segment.name
 	}
+	return fieldNames
+}
 
-	return root, nil
+// normalizeSegments is NormalizePaths for the paths split into field names.
+func normalizeSegments(paths [][]string) [][]string {
+	indexes := normalizedIndexes(paths)
+	if len(indexes) == len(paths) {
+		return paths
+	}
+	result := make([][]string, len(indexes))
+	for i, index := range indexes {
+		result[i] = paths[index]
+	}
+	return result
+}
+
+// normalizedIndexes returns the indexes of the `paths` that are neither duplicates nor sub paths of other paths.
+func normalizedIndexes(paths [][]string) []int {
+	set := make(map[string]bool, len(paths))
+	for _, fieldNames := range paths {
+		set[pathKey(fieldNames)] = true
+	}
+	seen := make(map[string]bool, len(paths))
+	indexes := make([]int, 0, len(paths))
+	for i, fieldNames := range paths {
+		k := pathKey(fieldNames)
+		if seen[k] || hasAncestor(fieldNames, set) {
+			continue
+		}
+		seen[k] = true
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// hasAncestor reports whether `set` contains the pathKey of a path that `fieldNames` is a sub path of.
+func hasAncestor(fieldNames []string, set map[string]bool) bool {
+	for i := 1; i < len(fieldNames); i++ {
+		if set[pathKey(fieldNames[:i])] {
+			return true
+		}
+	}
+	return false
+}
+
+// pathKey joins the field names with a byte that can not be a part of a field name.
+func pathKey(fieldNames []string) string {
+	return strings.Join(fieldNames, "\x00")
+}
+
+// pathPrefix makes sure the non-empty `prefix` ends with a dot, so that it only matches whole path segments.
+func pathPrefix(prefix string) string {
+	prefix = strings.TrimSuffix(prefix, ".")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "."
+}
+
+// pathSegment is a single field name of a dotted FieldMask path.
+type pathSegment struct {
+	name string
+	// quoted is true for the segments enclosed in backticks (e.g. map keys that contain dots).
+	quoted bool
+}
+
+// splitPath splits a FieldMask path by dots. Segments may be enclosed in backticks in order to contain dots,
+// e.g. "labels.`foo.bar`" is split to "labels" and "foo.bar". A literal backtick inside a quoted segment is escaped
+// by doubling it.
+func splitPath(path string) ([]pathSegment, error) {
+	var (
+		segments []pathSegment
+		current  []rune
+		quoted   bool
+		inQuotes bool
+	)
+	runes := []rune(path)
+	for pos := 0; pos < len(runes); pos++ {
+		char := runes[pos]
+		switch {
+		case inQuotes && char == '`':
+			if pos+1 < len(runes) && runes[pos+1] == '`' {
+				// Escaped backtick.
+				current = append(current, char)
+				pos++
+				continue
+			}
+			inQuotes = false
+			if pos+1 < len(runes) && runes[pos+1] != '.' {
+				return nil, errors.Errorf("unexpected character after a quoted field name at %d in \"%s\"", pos+1, path)
+			}
+
+		case inQuotes:
+			current = append(current, char)
+
+		case char == '`' && len(current) == 0 && !quoted:
+			quoted = true
+			inQuotes = true
+
+		case char == '.':
+			segments = append(segments, pathSegment{name: string(current), quoted: quoted})
+			current, quoted = nil, false
+
+		default:
+			current = append(current, char)
+		}
+	}
+	if inQuotes {
+		return nil, errors.Errorf("unterminated quoted field name in \"%s\"", path)
+	}
+	return append(segments, pathSegment{name: string(current), quoted: quoted}), nil
+}
+
+// MaskFromQuery creates a Mask from the comma separated paths found in the `key` query parameter
+// (e.g. "fields=id,avatar.original_url"). The parameter may be repeated. The paths are handled the same way as in
+// MaskFromProtoFieldMask, so `opts` such as Naming and Whitelist are supported.
+func MaskFromQuery(values url.Values, key string, opts ...interface{}) (Mask, error) {
+	var paths []string
+	for _, value := range values[key] {
+		for _, path := range strings.Split(value, ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			paths = append(paths, path)
+		}
+	}
+	return MaskFromProtoFieldMask(&types.FieldMask{Paths: paths}, opts...)
 }
 
 // MaskFromString creates a `Mask` from a string `s`.
 // `s` is supposed to be a valid string representation of a FieldFilter like "a,b,c{d,e{f,g}},d".
 // This is the same string format as in FieldFilter.String(). This function should only be used in tests as it does not
-// validate the given string and is only convenient to easily create DefaultMasks.
+// validate the given string and is only convenient to easily create DefaultMasks. Use ParseMask to validate the input.
+// It never panics: the malformed parts of `s`, such as a sub mask without a field name, are ignored.
 func MaskFromString(s string) Mask {
 	mask, _ := maskFromRunes([]rune(s))
 	return mask
@@ -199,7 +798,10 @@ func maskFromRunes(runes []rune) (Mask, int) {
 					pos += 1
 					continue
 				default:
-					panic("invalid mask string format")
+					// A sub mask without a field name: skip it.
+					_, jump := maskFromRunes(runes[pos+1:])
+					pos += jump + 2
+					continue
 				}
 			}
 
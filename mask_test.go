@@ -1,12 +1,16 @@
 package fieldmask_utils_test
 
 import (
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/protoc-gen-go/generator"
 	"github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMask_String(t *testing.T) {
@@ -21,15 +25,20 @@ func TestMaskFromProtoFieldMaskSuccess(t *testing.T) {
 	}{
 		{
 			&types.FieldMask{Paths: []string{
-				"a", // overwritten by the paths below (a.*)
+				"a", // selects the paths below (a.*) entirely
 				"a.b.c",
 				"a.b.d",
 				"a.c.d",
 				"b.c.d",
-				"a", // has no effect, since more strict rules are applied above
+				"a", // has no effect, since a is already selected entirely
 				"c",
 			}},
-			"a{b{c,d},c{d}},b{c{d}},c",
+			"a,b{c{d}},c",
+		},
+		{
+			// The overlapping paths are normalized: the larger scope wins whatever the order.
+			&types.FieldMask{Paths: []string{"b.c.d", "b.c.e", "b.c", "d.e", "d", "e.f", "e.fg"}},
+			"b{c},d,e{f,fg}",
 		},
 		{
 			&types.FieldMask{Paths: []string{"a", "b", "b", "a"}},
@@ -47,6 +56,23 @@ func TestMaskFromProtoFieldMaskSuccess(t *testing.T) {
 	}
 }
 
+func TestNormalizePaths(t *testing.T) {
+	testCases := []struct {
+		paths    []string
+		expected []string
+	}{
+		{[]string{"a", "a.b", "a.b.c"}, []string{"a"}},
+		{[]string{"a.b.c", "a.b", "d", "a.b"}, []string{"a.b", "d"}},
+		{[]string{"a.b", "a.bc", "ab.c", "a"}, []string{"ab.c", "a"}},
+		{[]string{"b", "a", "b"}, []string{"b", "a"}},
+		{[]string{"a.`b.c`", "a.b", "a.`b.c`.d"}, []string{"a.`b.c`", "a.b"}},
+		{nil, []string{}},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, fieldmask_utils.NormalizePaths(testCase.paths), testCase.paths)
+	}
+}
+
 func TestMaskFromProtoFieldMask_Failure(t *testing.T) {
 	testCases := []*types.FieldMask{
 		{Paths: []string{"a", ".a"}},
@@ -117,3 +143,437 @@ func TestMaskFromString(t *testing.T) {
 		assert.Equal(t, testCase.length, len(mask))
 	}
 }
+
+func TestMask_StringDeterministic(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("d,c{f,e},b,a{h,g{j,i}}")
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "a{g{i,j},h},b,c{e,f},d", mask.String())
+	}
+}
+
+func TestMaskInverse_StringDeterministic(t *testing.T) {
+	mask := fieldmask_utils.MaskInverse{"b": nil, "a": fieldmask_utils.MaskInverse{"d": nil, "c": nil}}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "a{c,d},b", mask.String())
+	}
+}
+
+func TestMask_FilterEmptyMaskSubFilter(t *testing.T) {
+	subFilter, ok := fieldmask_utils.Mask{}.Filter("foo")
+	assert.True(t, ok)
+	assert.Len(t, subFilter, 0)
+
+	subFilter, ok = fieldmask_utils.MaskFromString("bar").Filter("foo")
+	assert.False(t, ok)
+	assert.Len(t, subFilter, 0)
+
+	subFilter, ok = fieldmask_utils.MaskInverse{"bar": nil}.Filter("foo")
+	assert.True(t, ok)
+	assert.Len(t, subFilter, 0)
+}
+
+func TestMaskFromQuery(t *testing.T) {
+	values := url.Values{"fields": {"a,b.c", " b.d ,", "e"}, "other": {"f"}}
+	mask, err := fieldmask_utils.MaskFromQuery(values, "fields")
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("a,b{c,d},e"), mask)
+
+	mask, err = fieldmask_utils.MaskFromQuery(values, "missing")
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.Mask{}, mask)
+}
+
+func TestMaskFromQueryWithOptions(t *testing.T) {
+	values := url.Values{"fields": {"original_url,resized_url"}}
+	mask, err := fieldmask_utils.MaskFromQuery(values, "fields", fieldmask_utils.Naming(generator.CamelCase))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("OriginalUrl,ResizedUrl"), mask)
+
+	_, err = fieldmask_utils.MaskFromQuery(values, "fields", fieldmask_utils.Whitelist{"original_url"})
+	assert.Error(t, err)
+
+	_, err = fieldmask_utils.MaskFromQuery(url.Values{"fields": {"a..b"}}, "fields")
+	assert.Error(t, err)
+}
+
+func TestNewMaskInverse(t *testing.T) {
+	testCases := []struct {
+		paths    []string
+		expected fieldmask_utils.MaskInverse
+	}{
+		{nil, fieldmask_utils.MaskInverse{}},
+		{[]string{"id", "friends.username"}, fieldmask_utils.MaskInverse{
+			"id":      nil,
+			"friends": fieldmask_utils.MaskInverse{"username": nil},
+		}},
+		{[]string{"a.b.c", "a.b.d", "a.e"}, fieldmask_utils.MaskInverse{
+			"a": fieldmask_utils.MaskInverse{
+				"b": fieldmask_utils.MaskInverse{"c": nil, "d": nil},
+				"e": nil,
+			},
+		}},
+		// Excluding a parent excludes the whole subtree regardless of the order.
+		{[]string{"a.b", "a"}, fieldmask_utils.MaskInverse{"a": nil}},
+		{[]string{"a", "a.b"}, fieldmask_utils.MaskInverse{"a": nil}},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, fieldmask_utils.NewMaskInverse(testCase.paths...))
+	}
+}
+
+func TestMaskInverseFromString(t *testing.T) {
+	mask := fieldmask_utils.MaskInverseFromString("id, meta.*,avatar.*,friends.username")
+	assert.Equal(t, fieldmask_utils.NewMaskInverse("id", "meta.*", "avatar.*", "friends.username"), mask)
+
+	dst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(mask, testUserFull, dst)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), dst.Id)
+	assert.Equal(t, testUserFull.Username, dst.Username)
+	assert.Equal(t, testUserFull.Tags, dst.Tags)
+	assert.Equal(t, map[string]string{}, dst.Meta)
+	assert.Equal(t, &testproto.Image{}, dst.Avatar)
+	require.Len(t, dst.Friends, 1)
+	assert.Equal(t, "", dst.Friends[0].Username)
+	assert.Equal(t, testUserFull.Friends[0].Meta, dst.Friends[0].Meta)
+
+	dstMap := make(map[string]interface{})
+	err = fieldmask_utils.StructToMap(mask, testUserFull, dstMap)
+	require.NoError(t, err)
+	assert.NotContains(t, dstMap, "id")
+	assert.Equal(t, testUserFull.Username, dstMap["username"])
+	assert.Equal(t, map[string]string{}, dstMap["meta"])
+	assert.Equal(t, map[string]interface{}{}, dstMap["avatar"])
+}
+
+func TestMaskFromProtoFieldMaskQuotedSegments(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromProtoFieldMask(&types.FieldMask{Paths: []string{
+		"labels.`foo.bar`",
+		"labels.baz",
+		"meta.`with``backtick`",
+		"meta.``",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.Mask{
+		"labels": fieldmask_utils.Mask{
+			"foo.bar": fieldmask_utils.Mask{},
+			"baz":     fieldmask_utils.Mask{},
+		},
+		"meta": fieldmask_utils.Mask{
+			"with`backtick": fieldmask_utils.Mask{},
+			"":              fieldmask_utils.Mask{},
+		},
+	}, mask)
+}
+
+func TestMaskFromProtoFieldMaskQuotedSegmentsNaming(t *testing.T) {
+	// Quoted segments are map keys, so they are not renamed.
+	mask, err := fieldmask_utils.MaskFromProtoFieldMask(
+		&types.FieldMask{Paths: []string{"meta.`foo_bar.baz`"}},
+		fieldmask_utils.Naming(generator.CamelCase),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.Mask{"Meta": fieldmask_utils.Mask{"foo_bar.baz": fieldmask_utils.Mask{}}}, mask)
+}
+
+func TestMaskFromProtoFieldMaskQuotedSegmentsFailure(t *testing.T) {
+	testCases := []*types.FieldMask{
+		{Paths: []string{"labels.`foo.bar"}},
+		{Paths: []string{"labels.`foo`bar"}},
+		{Paths: []string{"labels.`foo`.`"}},
+	}
+	for _, fieldMask := range testCases {
+		_, err := fieldmask_utils.MaskFromProtoFieldMask(fieldMask)
+		assert.Error(t, err, fieldMask.Paths)
+	}
+}
+
+func TestMaskFromProtoFieldMaskTrimPrefix(t *testing.T) {
+	fieldMask := &types.FieldMask{Paths: []string{"user.profile.name", "user.id", "etag"}}
+
+	mask, err := fieldmask_utils.MaskFromProtoFieldMask(fieldMask, fieldmask_utils.TrimPrefix("user"))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("profile{name},id,etag"), mask)
+
+	// A trailing dot in the prefix is optional.
+	mask, err = fieldmask_utils.MaskFromProtoFieldMask(fieldMask, fieldmask_utils.TrimPrefix("user."))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("profile{name},id,etag"), mask)
+
+	// Only the whole leading segment is trimmed.
+	mask, err = fieldmask_utils.MaskFromProtoFieldMask(&types.FieldMask{Paths: []string{"username"}},
+		fieldmask_utils.TrimPrefix("user"))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("username"), mask)
+}
+
+func TestMaskFromProtoFieldMaskEmptyWithWhitelist(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromProtoFieldMask(
+		&types.FieldMask{},
+		fieldmask_utils.Whitelist{"id", "avatar.original_url"},
+		fieldmask_utils.Naming(generator.CamelCase),
+		fieldmask_utils.StrictTrimPrefix("user"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("Id,Avatar{OriginalUrl}"), mask)
+}
+
+func TestMaskFromProtoFieldMaskStrictTrimPrefix(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromProtoFieldMask(
+		&types.FieldMask{Paths: []string{"user.profile.name", "user.id"}},
+		fieldmask_utils.StrictTrimPrefix("user"),
+		fieldmask_utils.Whitelist{"profile.name", "id"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("profile{name},id"), mask)
+
+	_, err = fieldmask_utils.MaskFromProtoFieldMask(
+		&types.FieldMask{Paths: []string{"user.profile.name", "id"}},
+		fieldmask_utils.StrictTrimPrefix("user"),
+	)
+	assert.Error(t, err)
+}
+
+func TestMask_Equal(t *testing.T) {
+	testCases := []struct {
+		a, b  fieldmask_utils.FieldFilter
+		equal bool
+	}{
+		{fieldmask_utils.MaskFromString("a,b{c,d{e}},f"), fieldmask_utils.MaskFromString("f,b{d{e},c},a"), true},
+		{fieldmask_utils.MaskFromString(""), fieldmask_utils.Mask(nil), true},
+		{fieldmask_utils.MaskFromString("a,b{c}"), fieldmask_utils.MaskFromString("a,b{d}"), false},
+		{fieldmask_utils.MaskFromString("a,b{c}"), fieldmask_utils.MaskFromString("a,b"), false},
+		{fieldmask_utils.MaskFromString("a"), fieldmask_utils.MaskFromString("a,b"), false},
+		{fieldmask_utils.MaskFromString("a"), fieldmask_utils.MaskInverse{"a": fieldmask_utils.Mask{}}, false},
+		{fieldmask_utils.MaskFromString("a"), nil, false},
+		{
+			fieldmask_utils.MaskInverse{"a": nil, "b": fieldmask_utils.MaskInverse{"c": nil}},
+			fieldmask_utils.NewMaskInverse("b.c", "a"),
+			true,
+		},
+		{
+			fieldmask_utils.MaskInverse{"a": nil},
+			fieldmask_utils.MaskInverse{"a": fieldmask_utils.MaskInverse{}},
+			false,
+		},
+		{fieldmask_utils.MaskInverse{"a": nil}, fieldmask_utils.MaskFromString("a"), false},
+	}
+	for _, testCase := range testCases {
+		type equaler interface {
+			Equal(fieldmask_utils.FieldFilter) bool
+		}
+		assert.Equal(t, testCase.equal, testCase.a.(equaler).Equal(testCase.b), "%s == %s", testCase.a, testCase.b)
+	}
+}
+
+func TestMask_Count(t *testing.T) {
+	testCases := []struct {
+		mask     string
+		expected int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"a,b{c,d}", 3},
+		{"a{b{c,d{e}}},f", 3},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, fieldmask_utils.MaskFromString(testCase.mask).Count(), testCase.mask)
+	}
+}
+
+func TestMask_Merge(t *testing.T) {
+	mask := fieldmask_utils.Mask{}
+	mask.Merge("id", "username")
+	isAdmin := true
+	if isAdmin {
+		mask.Merge("avatar.original_url", "avatar.resized_url")
+	}
+	mask.Merge("friends.avatar.original_url", "id")
+	assert.Equal(t,
+		fieldmask_utils.MaskFromString("id,username,avatar{original_url,resized_url},friends{avatar{original_url}}"),
+		mask)
+
+	// A nil sub filter is replaced.
+	mask = fieldmask_utils.Mask{"avatar": nil}
+	mask.Merge("avatar.original_url", ".tags.")
+	assert.Equal(t, fieldmask_utils.MaskFromString("avatar{original_url},tags"), mask)
+
+	// The larger scope wins.
+	mask = fieldmask_utils.MaskFromString("id,avatar{original_url}")
+	mask.Merge("id.foo", "avatar")
+	assert.Equal(t, fieldmask_utils.MaskFromString("id,avatar"), mask)
+}
+
+func TestMask_Remove(t *testing.T) {
+	mask := fieldmask_utils.MaskFromString("id,avatar{original_url,resized_url},friends{avatar{original_url}}")
+
+	assert.True(t, mask.Remove("avatar.resized_url"))
+	assert.Equal(t, fieldmask_utils.MaskFromString("id,avatar{original_url},friends{avatar{original_url}}"), mask)
+
+	// The parents left empty are pruned.
+	assert.True(t, mask.Remove("friends.avatar.original_url"))
+	assert.Equal(t, fieldmask_utils.MaskFromString("id,avatar{original_url}"), mask)
+
+	assert.True(t, mask.Remove("avatar"))
+	assert.Equal(t, fieldmask_utils.MaskFromString("id"), mask)
+
+	// The paths not present in the mask are not removed, same as the sub paths of the fields selected entirely.
+	assert.False(t, mask.Remove("username"))
+	assert.False(t, mask.Remove("id.foo"))
+	assert.False(t, mask.Remove(""))
+	assert.Equal(t, fieldmask_utils.MaskFromString("id"), mask)
+}
+
+func TestMaskInverse_Count(t *testing.T) {
+	assert.Equal(t, 0, fieldmask_utils.NewMaskInverse().Count())
+	assert.Equal(t, 3, fieldmask_utils.NewMaskInverse("id", "avatar.original_url", "avatar.resized_url").Count())
+}
+
+func TestFilterFunc(t *testing.T) {
+	// Only allow the top level fields starting with "i", the sub fields are all copied.
+	filter := fieldmask_utils.FilterFunc(func(fieldName string) (fieldmask_utils.FieldFilter, bool) {
+		return fieldmask_utils.Mask{}, strings.HasPrefix(fieldName, "i")
+	})
+	src := &testproto.User{
+		Id:       1,
+		Username: "johnny",
+		Images:   []*testproto.Image{{OriginalUrl: "original.jpg"}},
+	}
+
+	userDst := &testproto.User{}
+	err := fieldmask_utils.StructToStruct(filter, src, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &testproto.User{Id: 1, Images: []*testproto.Image{{OriginalUrl: "original.jpg"}}}, userDst)
+
+	mapDst, err := filter.StructToMap(src)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":     uint32(1),
+		"images": []map[string]interface{}{{"original_url": "original.jpg", "resized_url": ""}},
+	}, mapDst)
+}
+
+func TestMaskInverseFromProtoFieldMask(t *testing.T) {
+	mask, err := fieldmask_utils.MaskInverseFromProtoFieldMask(
+		&types.FieldMask{Paths: []string{"id", "friends.username"}})
+	require.NoError(t, err)
+	assert.Equal(t,
+		fieldmask_utils.MaskInverse{"id": nil, "friends": fieldmask_utils.MaskInverse{"username": nil}}, mask)
+
+	// Excluding a whole field overrides the exclusion of its sub fields.
+	mask, err = fieldmask_utils.MaskInverseFromProtoFieldMask(
+		&types.FieldMask{Paths: []string{"Friends.Username", "Friends"}}, fieldmask_utils.Naming(generator.CamelCase))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskInverse{"Friends": nil}, mask)
+}
+
+func TestMaskInverseFromProtoFieldMaskWhitelist(t *testing.T) {
+	whitelist := fieldmask_utils.Whitelist{"id", "avatar.original_url"}
+	mask, err := fieldmask_utils.MaskInverseFromProtoFieldMask(
+		&types.FieldMask{Paths: []string{"avatar.original_url"}}, whitelist)
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskInverse{"avatar": fieldmask_utils.MaskInverse{"original_url": nil}}, mask)
+
+	_, err = fieldmask_utils.MaskInverseFromProtoFieldMask(&types.FieldMask{Paths: []string{"username"}}, whitelist)
+	assert.Error(t, err)
+}
+
+func TestMaskFromStringMalformed(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected fieldmask_utils.Mask
+	}{
+		{"a{", fieldmask_utils.Mask{"a": fieldmask_utils.Mask{}}},
+		{"}", fieldmask_utils.Mask{}},
+		{"{a},b", fieldmask_utils.Mask{"b": fieldmask_utils.Mask{}}},
+		{"a,{b{c}}", fieldmask_utils.Mask{"a": fieldmask_utils.Mask{}}},
+		{"{", fieldmask_utils.Mask{}},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, fieldmask_utils.MaskFromString(testCase.input), testCase.input)
+	}
+}
+
+func TestMask_FilterSharedEmptySubFilter(t *testing.T) {
+	empty := fieldmask_utils.Mask{}
+	mask := fieldmask_utils.MaskFromString("foo{bar},baz")
+	recursive := fieldmask_utils.MaskFromString("**")
+	inverse := fieldmask_utils.MaskInverse{"foo": nil}
+	allocs := testing.AllocsPerRun(100, func() {
+		empty.Filter("foo")
+		mask.Filter("qux")
+		recursive.Filter("qux")
+		inverse.Filter("qux")
+	})
+	assert.Zero(t, allocs)
+
+	// The sub filters of distinct fields are the same shared value: it can not be mutated, so that changing the sub
+	// filter of one field can not silently change the sub filter of another one.
+	subFilter, _ := empty.Filter("foo")
+	assert.Panics(t, func() { subFilter.(fieldmask_utils.Mask)["bar"] = fieldmask_utils.Mask{} })
+	inverseSubFilter, _ := inverse.Filter("qux")
+	assert.Panics(t, func() { inverseSubFilter.(fieldmask_utils.MaskInverse)["bar"] = nil })
+
+	// Merging into the mask selecting a field entirely leaves the shared value intact.
+	merged := fieldmask_utils.Mask{"foo": subFilter}
+	merged.Merge("foo.bar")
+	subFilter, _ = empty.Filter("baz")
+	assert.Len(t, subFilter, 0)
+
+	// The copying functions do not mutate it either.
+	userDst := &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(recursive, testUserFull, userDst))
+	assert.Equal(t, testUserFull.Avatar, userDst.Avatar)
+	subFilter, _ = empty.Filter("baz")
+	assert.Len(t, subFilter, 0)
+}
+
+func TestMask_StringCyclic(t *testing.T) {
+	mask := fieldmask_utils.Mask{"b": fieldmask_utils.Mask{}}
+	mask["a"] = mask
+	assert.Equal(t, "a{...},b", mask.String())
+
+	inverse := fieldmask_utils.MaskInverse{"b": nil}
+	inverse["a"] = fieldmask_utils.MaskInverse{"c": inverse}
+	assert.Equal(t, "a{c{...}},b", inverse.String())
+
+	// A sub mask shared by several fields is not a cycle.
+	shared := fieldmask_utils.Mask{"c": fieldmask_utils.Mask{}}
+	assert.Equal(t, "a{c},b{c}", fieldmask_utils.Mask{"a": shared, "b": shared}.String())
+}
+
+func TestMaskCyclic(t *testing.T) {
+	mask := fieldmask_utils.Mask{"a": nil}
+	mask["a"] = mask
+	assert.Equal(t, 0, mask.Count())
+
+	inverse := fieldmask_utils.MaskInverse{"b": nil}
+	inverse["a"] = fieldmask_utils.MaskInverse{"c": inverse}
+	assert.Equal(t, 0, inverse.Count())
+
+	// The masks with the same cycles are equal.
+	other := fieldmask_utils.Mask{"a": nil}
+	other["a"] = fieldmask_utils.Mask{"a": other}
+	assert.True(t, mask.Equal(mask))
+	assert.True(t, mask.Equal(other))
+	assert.False(t, mask.Equal(fieldmask_utils.MaskFromString("a{a{a}}")))
+	assert.True(t, inverse.Equal(inverse))
+
+	// A cyclic mask is left unchanged by Merge.
+	mask.Merge("a.b")
+	assert.Len(t, mask, 1)
+	assert.Equal(t, "a{...}", mask.String())
+}
+
+func TestMaskFromProtoFieldMaskNormalizesTrimmedPaths(t *testing.T) {
+	// The paths overlap once the prefix is trimmed.
+	fm := &types.FieldMask{Paths: []string{"user.avatar", "avatar.original_url"}}
+	mask, err := fieldmask_utils.MaskFromProtoFieldMask(fm, fieldmask_utils.TrimPrefix("user"))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("avatar"), mask)
+
+	// Every path is checked against the whitelist, including the ones subsumed by other paths.
+	fm = &types.FieldMask{Paths: []string{"avatar", "avatar.original_url"}}
+	_, err = fieldmask_utils.MaskFromProtoFieldMask(fm, fieldmask_utils.Whitelist{"avatar"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,238 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MaskFromFieldNumbers creates a Mask that selects the fields of the protobuf message type `msgType` with the given
+// field numbers. The field numbers are read from the `protobuf` struct tags. The mask uses the same field names
+// the copying functions resolve from the tags, so selecting a oneof variant results in a nested mask,
+// e.g. "name{male_name}".
+func MaskFromFieldNumbers(msgType reflect.Type, numbers []int32) (Mask, error) {
+	for msgType.Kind() == reflect.Ptr {
+		msgType = msgType.Elem()
+	}
+	if msgType.Kind() != reflect.Struct {
+		return nil, errors.Errorf("%s is not a message type", msgType)
+	}
+
+	paths := fieldNumberPaths(msgType)
+	mask := make(Mask)
+	for _, number := range numbers {
+		path, ok := paths[number]
+		if !ok {
+			return nil, errors.Errorf("field number %d is not present in %s", number, msgType)
+		}
+		node := mask
+		for _, fieldName := range path {
+			subNode, ok := node[fieldName].(Mask)
+			if !ok {
+				subNode = make(Mask)
+				node[fieldName] = subNode
+			}
+			node = subNode
+		}
+	}
+	return mask, nil
+}
+
+// MaskFromFieldNames creates a Mask that selects the fields of the struct type `msgType` with the given Go field
+// names. Nested fields are selected with dotted names, e.g. "Avatar.OriginalUrl", oneof variants are selected by
+// the names of the fields of their wrappers, e.g. "Name.MaleName". The mask uses the same field names the copying
+// functions resolve from the tags.
+func MaskFromFieldNames(msgType reflect.Type, goFieldNames ...string) (Mask, error) {
+	msgType = indirectType(msgType)
+	if msgType.Kind() != reflect.Struct {
+		return nil, errors.Errorf("%s is not a message type", msgType)
+	}
+
+	mask := make(Mask)
+	for _, goFieldName := range goFieldNames {
+		var (
+			node  = mask
+			t     = msgType
+			oneof *reflect.StructField
+		)
+		for _, segment := range strings.Split(goFieldName, ".") {
+			if t == nil {
+				return nil, errors.Errorf("field %s of %s has no sub fields", goFieldName, msgType)
+			}
+			field, ok := goField(t, segment, oneof)
+			if !ok {
+				return nil, errors.Errorf("field %s is not present in %s", goFieldName, msgType)
+			}
+			name, ok := fieldNameFromTags(field, defaultTagNames)
+			if !ok {
+				return nil, errors.Errorf("field %s of %s is excluded by its tags", goFieldName, msgType)
+			}
+
+			subNode, ok := node[name].(Mask)
+			if !ok {
+				subNode = make(Mask)
+				node[name] = subNode
+			}
+			node = subNode
+
+			oneof = nil
+			if _, ok := field.Tag.Lookup("protobuf_oneof"); ok {
+				oneof = &field
+				continue
+			}
+			t = indirectType(field.Type)
+			switch t.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				t = indirectType(t.Elem())
+			}
+			if t.Kind() != reflect.Struct {
+				t = nil
+			}
+		}
+	}
+	return mask, nil
+}
+
+// goField returns the exported field `name` of the struct type `t`. If `oneof` is not nil the field is looked up in
+// the wrappers of the variants of that oneof field of `t` instead.
+func goField(t reflect.Type, name string, oneof *reflect.StructField) (reflect.StructField, bool) {
+	types := []reflect.Type{t}
+	if oneof != nil {
+		types = oneofFieldWrappers(t, *oneof)
+	}
+	for _, t := range types {
+		t = indirectType(t)
+		if t.Kind() != reflect.Struct {
+			continue
+		}
+		if field, ok := t.FieldByName(name); ok && field.PkgPath == "" {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// fieldNumberPaths maps the field numbers of the message type `t` to the corresponding mask paths.
+func fieldNumberPaths(t reflect.Type) map[int32][]string {
+	paths := make(map[int32][]string)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name, ok := field.Tag.Lookup("protobuf_oneof"); ok {
+			// The numbers of the oneof variants are defined in the wrapper types.
+			for _, wrapper := range oneofFieldWrappers(t, field) {
+				wrapper = indirectType(wrapper)
+				if wrapper.Kind() != reflect.Struct || wrapper.NumField() != 1 {
+					continue
+				}
+				if number, variant, ok := protobufFieldNumber(wrapper.Field(0)); ok {
+					paths[number] = []string{name, variant}
+				}
+			}
+			continue
+		}
+		if number, name, ok := protobufFieldNumber(field); ok {
+			paths[number] = []string{name}
+		}
+	}
+	return paths
+}
+
+// fieldNumberMapping returns the `dstFields` mapping of the dst struct type `dstType` changed so that the src fields
+// having a protobuf field number map to the dst fields having the same number regardless of their names.
+// The src fields without a dst field of the same number are removed from the mapping.
+func fieldNumberMapping(srcType, dstType reflect.Type, srcFields, dstFields map[string]string) map[string]string {
+	dstByNumber := make(map[int32]string)
+	for i := 0; i < dstType.NumField(); i++ {
+		if number, _, ok := protobufFieldNumber(dstType.Field(i)); ok {
+			dstByNumber[number] = dstType.Field(i).Name
+		}
+	}
+
+	mapping := make(map[string]string, len(dstFields))
+	for name, fieldName := range dstFields {
+		mapping[name] = fieldName
+	}
+	for i := 0; i < srcType.NumField(); i++ {
+		field := srcType.Field(i)
+		srcName, ok := srcFields[field.Name]
+		if !ok {
+			continue
+		}
+		number, _, ok := protobufFieldNumber(field)
+		if !ok {
+			continue
+		}
+		if dstName, ok := dstByNumber[number]; ok {
+			mapping[srcName] = dstName
+		} else {
+			delete(mapping, srcName)
+		}
+	}
+	return mapping
+}
+
+// protobufFieldNumber parses the field number and name from a `protobuf:"bytes,1,opt,name=id,proto3"` tag.
+func protobufFieldNumber(field reflect.StructField) (int32, string, bool) {
+	parts := strings.Split(field.Tag.Get("protobuf"), ",")
+	if len(parts) < 2 {
+		return 0, "", false
+	}
+	number, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return 0, "", false
+	}
+	name := field.Name
+	for _, part := range parts {
+		if strings.HasPrefix(part, "name=") {
+			name = strings.TrimPrefix(part, "name=")
+		}
+	}
+	return int32(number), name, true
+}
+
+// oneofWrappers returns the oneof wrapper types of the message type `t` as reported by the generated
+// XXX_OneofWrappers method.
+func oneofWrappers(t reflect.Type) []reflect.Type {
+	method := reflect.New(t).MethodByName("XXX_OneofWrappers")
+	if !method.IsValid() {
+		return nil
+	}
+	out := method.Call(nil)
+	if len(out) != 1 {
+		return nil
+	}
+	wrappers, ok := out[0].Interface().([]interface{})
+	if !ok {
+		return nil
+	}
+	types := make([]reflect.Type, 0, len(wrappers))
+	for _, wrapper := range wrappers {
+		types = append(types, reflect.TypeOf(wrapper))
+	}
+	return types
+}
+
+// oneofFieldWrappers returns the oneof wrapper types of the message type `t` that implement the interface type of its
+// oneof `field`, i.e. the variants of that oneof only.
+func oneofFieldWrappers(t reflect.Type, field reflect.StructField) []reflect.Type {
+	if field.Type.Kind() != reflect.Interface {
+		return nil
+	}
+	var wrappers []reflect.Type
+	for _, wrapper := range oneofWrappers(t) {
+		if wrapper.Implements(field.Type) ||
+			(wrapper.Kind() != reflect.Ptr && reflect.PtrTo(wrapper).Implements(field.Type)) {
+			wrappers = append(wrappers, wrapper)
+		}
+	}
+	return wrappers
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,142 @@
+package fieldmask_utils_test
+
+import (
+	"reflect"
+	"testing"
+
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskFromFieldNumbers(t *testing.T) {
+	testCases := []struct {
+		numbers  []int32
+		expected string
+	}{
+		{[]int32{1, 2, 11}, "id,username,avatar"},
+		{[]int32{7, 14}, "name{male_name,profile}"},
+		{[]int32{13, 13}, "friends"},
+		{nil, ""},
+	}
+	for _, testCase := range testCases {
+		mask, err := fieldmask_utils.MaskFromFieldNumbers(reflect.TypeOf(&testproto.User{}), testCase.numbers)
+		require.NoError(t, err)
+		assert.Equal(t, fieldmask_utils.MaskFromString(testCase.expected), mask)
+	}
+}
+
+func TestMaskFromFieldNumbersCopy(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromFieldNumbers(reflect.TypeOf(testproto.User{}), []int32{1, 7})
+	require.NoError(t, err)
+	userDst := &testproto.User{}
+	require.NoError(t, fieldmask_utils.StructToStruct(mask, testUserFull, userDst))
+	assert.Equal(t, &testproto.User{Id: testUserFull.Id, Name: testUserFull.Name}, userDst)
+}
+
+func TestMaskFromFieldNumbersFail(t *testing.T) {
+	_, err := fieldmask_utils.MaskFromFieldNumbers(reflect.TypeOf(&testproto.User{}), []int32{1, 100})
+	assert.Error(t, err)
+
+	_, err = fieldmask_utils.MaskFromFieldNumbers(reflect.TypeOf(1), []int32{1})
+	assert.Error(t, err)
+}
+
+func TestMaskFromFieldNames(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromFieldNames(reflect.TypeOf(&testproto.User{}),
+		"Id", "Avatar.OriginalUrl", "Friends.Username", "Name.MaleName", "Name.Profile.DisplayName")
+	require.NoError(t, err)
+	assert.Equal(t,
+		fieldmask_utils.MaskFromString("id,avatar{original_url},friends{username},name{male_name,profile{display_name}}"),
+		mask)
+}
+
+func TestMaskFromFieldNamesFail(t *testing.T) {
+	for _, goFieldName := range []string{"Bogus", "Avatar.Bogus", "Username.Length", "Name.Bogus", "XXX_sizecache"} {
+		_, err := fieldmask_utils.MaskFromFieldNames(reflect.TypeOf(testproto.User{}), goFieldName)
+		assert.Error(t, err, goFieldName)
+	}
+}
+
+func TestStructToStructWithMatchByFieldNumber(t *testing.T) {
+	// ImageV2 is the Image message with the fields renamed.
+	type ImageV2 struct {
+		Url        string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+		ResizedUrl string `protobuf:"bytes,2,opt,name=thumbnail_url,proto3" json:"thumbnail_url,omitempty"`
+		Comment    string `json:"comment"`
+	}
+	type AccountV2 struct {
+		Id     uint32   `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+		Login  string   `protobuf:"bytes,2,opt,name=login,proto3" json:"login,omitempty"`
+		Avatar *ImageV2 `protobuf:"bytes,11,opt,name=picture,proto3" json:"picture,omitempty"`
+	}
+
+	dst := &AccountV2{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("id,username,avatar{original_url}"),
+		testUserFull, dst, fieldmask_utils.WithMatchByFieldNumber())
+	require.NoError(t, err)
+	assert.Equal(t, &AccountV2{Id: 1, Login: "username", Avatar: &ImageV2{Url: "original.jpg"}}, dst)
+
+	// The fields without numbers are matched by name.
+	image := &ImageV2{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &struct {
+		Comment string `json:"comment"`
+	}{Comment: "nice"}, image, fieldmask_utils.WithMatchByFieldNumber())
+	require.NoError(t, err)
+	assert.Equal(t, &ImageV2{Comment: "nice"}, image)
+
+	// The names do not match without the option.
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("username"), testUserFull, &AccountV2{})
+	assert.Error(t, err)
+}
+
+// twoOneofs is a message with two oneofs, a{a1,a2} and b{b1}.
+type twoOneofs struct {
+	A isTwoOneofsA `protobuf_oneof:"a"`
+	B isTwoOneofsB `protobuf_oneof:"b"`
+}
+
+type isTwoOneofsA interface {
+	isTwoOneofsA()
+}
+
+type isTwoOneofsB interface {
+	isTwoOneofsB()
+}
+
+type twoOneofsA1 struct {
+	A1 string `protobuf:"bytes,1,opt,name=a1,proto3,oneof"`
+}
+
+type twoOneofsA2 struct {
+	A2 string `protobuf:"bytes,3,opt,name=a2,proto3,oneof"`
+}
+
+type twoOneofsB1 struct {
+	B1 string `protobuf:"bytes,2,opt,name=b1,proto3,oneof"`
+}
+
+func (*twoOneofsA1) isTwoOneofsA() {}
+func (*twoOneofsA2) isTwoOneofsA() {}
+func (*twoOneofsB1) isTwoOneofsB() {}
+
+func (*twoOneofs) XXX_OneofWrappers() []interface{} {
+	return []interface{}{(*twoOneofsA1)(nil), (*twoOneofsA2)(nil), (*twoOneofsB1)(nil)}
+}
+
+func TestMaskFromFieldNumbersTwoOneofs(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromFieldNumbers(reflect.TypeOf(&twoOneofs{}), []int32{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("a{a1},b{b1}"), mask)
+}
+
+func TestMaskFromFieldNamesTwoOneofs(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromFieldNames(reflect.TypeOf(&twoOneofs{}), "A.A1", "B.B1")
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("a{a1},b{b1}"), mask)
+
+	// The variants of another oneof are not present.
+	_, err = fieldmask_utils.MaskFromFieldNames(reflect.TypeOf(&twoOneofs{}), "A.B1")
+	assert.Error(t, err)
+}
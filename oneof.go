@@ -0,0 +1,54 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+)
+
+// WithOneofWrappers registers the dst oneof wrapper types, e.g. (*gogopb.User_MaleName)(nil), the same way the
+// generated XXX_OneofWrappers methods list them. StructToStruct uses them to copy the oneof fields between messages
+// generated by different generators (e.g. golang/protobuf and gogo/protobuf): if the src wrapper does not implement
+// the dst oneof interface, the src variant is copied to a new registered wrapper that implements the dst interface
+// and has a single field of the same name.
+func WithOneofWrappers(wrappers ...interface{}) Option {
+	return func(o *options) {
+		for _, wrapper := range wrappers {
+			o.dstOneofWrappers = append(o.dstOneofWrappers, reflect.TypeOf(wrapper))
+		}
+	}
+}
+
+// oneofWrapperFor returns the registered wrapper type implementing `dstType` that wraps the same variant as the src
+// oneof wrapper `srcWrapper`.
+func (o *options) oneofWrapperFor(srcWrapper reflect.Value, dstType reflect.Type) (reflect.Type, bool) {
+	if srcWrapper.Kind() == reflect.Interface {
+		srcWrapper = srcWrapper.Elem()
+	}
+	if indirect(srcWrapper).Kind() != reflect.Struct {
+		return nil, false
+	}
+	srcName, ok := oneofVariantName(o.fieldMapping(indirect(srcWrapper), false))
+	if !ok {
+		return nil, false
+	}
+	for _, wrapper := range o.dstOneofWrappers {
+		if wrapper.Kind() != reflect.Ptr || wrapper.Elem().Kind() != reflect.Struct || wrapper.Elem().NumField() != 1 ||
+			!wrapper.Implements(dstType) {
+			continue
+		}
+		if _, ok := o.dstFieldMapping(reflect.New(wrapper.Elem()).Elem())[srcName]; ok {
+			return wrapper, true
+		}
+	}
+	return nil, false
+}
+
+// oneofVariantName returns the name of the single field of a oneof wrapper given its field `mapping`.
+func oneofVariantName(mapping map[string]string) (string, bool) {
+	if len(mapping) != 1 {
+		return "", false
+	}
+	for _, name := range mapping {
+		return name, true
+	}
+	return "", false
+}
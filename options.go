@@ -0,0 +1,817 @@
+package fieldmask_utils
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Option is a functional option that modifies the behavior of the copying functions.
+// Options are passed alongside the other variadic opts (e.g. Naming or Whitelist) and are ignored where not applicable.
+type Option func(*options)
+
+type options struct {
+	// dstName resolves the dst field name for the given src field path.
+	dstName func(srcPath string) string
+	// errorOnUnsupported makes the copying fail on chan, func and unsafe pointer fields instead of skipping them.
+	errorOnUnsupported bool
+	// defaultMask replaces an empty Mask passed to the copying functions.
+	defaultMask Mask
+	// typeFormatters control how the values of specific types are represented in StructToMap output.
+	typeFormatters map[reflect.Type]func(reflect.Value) interface{}
+	// sliceMerge defines how slices of messages are copied to dst slices.
+	sliceMerge SliceMerge
+	// nativeStructValues makes StructToMap convert the google.protobuf.Struct family to native Go values.
+	nativeStructValues bool
+	// bestEffort makes StructToStruct skip the fields that fail to be copied and record the errors instead.
+	bestEffort bool
+	errors     []error
+	// nilAsEmptyMap makes StructToMap emit empty maps for nil message pointers.
+	nilAsEmptyMap bool
+	// rawJSON makes StructToStruct marshal the src fields to JSON when dst fields are json.RawMessage.
+	rawJSON bool
+	// errorOnNilSrc makes the copying functions fail on a nil src instead of leaving dst untouched.
+	errorOnNilSrc bool
+	// atomic makes StructToStruct leave dst unchanged if the copying fails.
+	atomic bool
+	// enumValidators check the values copied to the fields of specific types.
+	enumValidators map[reflect.Type]func(reflect.Value) bool
+	// flattenOneof makes StructToMap put the fields of the oneof wrappers to the parent map.
+	flattenOneof bool
+	// strictTypes disables the implicit conversions between distinct types.
+	strictTypes bool
+	// mapEntryPaths are the src field paths of the repeated key/value entry messages copied to dst maps.
+	mapEntryPaths map[string]bool
+	// unwrapOneof makes StructToStruct copy the oneof variants to the parent dst struct if it lacks the oneof field.
+	unwrapOneof bool
+	// protoJSONNames makes the copying functions name the protobuf fields after their JSON names.
+	protoJSONNames bool
+	// emptySlices defines how StructToStruct copies nil and empty slices.
+	emptySlices EmptySlices
+	// getters makes the copying functions read the src fields through their GetXxx methods.
+	getters bool
+	// resetDst makes StructToStruct zero dst before copying.
+	resetDst bool
+	// logger receives the field decisions made by the copying functions.
+	logger func(format string, args ...interface{})
+	// errorOnArrayOverflow makes StructToStruct fail if a src slice does not fit in a dst array.
+	errorOnArrayOverflow bool
+	// sortedMapEntries makes StructToMap emit the maps as slices of entries sorted by key.
+	sortedMapEntries bool
+	// keyRenames maps the dotted src field paths to the keys StructToMap uses for them.
+	keyRenames map[string]string
+	// opaqueTypes are the types that are copied as is rather than descended into.
+	opaqueTypes map[reflect.Type]bool
+	// adapters convert the src values of specific types to specific dst types.
+	adapters map[adapterKey]func(reflect.Value) (reflect.Value, error)
+	// requireFullCoverage makes the copying functions fail if any src field is not selected by the filter.
+	requireFullCoverage bool
+	uncovered           []string
+	// stringTransform is applied to every copied string value.
+	stringTransform func(string) string
+	// anyFilters are the filters of the messages packed into the Any fields keyed by the type URL or name.
+	anyFilters  map[string]FieldFilter
+	anyResolver AnyResolver
+	// matchByFieldNumber maps the src fields to the dst fields by their protobuf field numbers.
+	matchByFieldNumber bool
+	// enumNameTransform makes StructToMap render the proto enums by their transformed names.
+	enumNameTransform func(string) string
+	// nilShape makes StructToMap emit the fields selected in nil messages as nil values.
+	nilShape bool
+	// defaults are the values copied instead of the zero src values, keyed by the field paths.
+	defaults map[string]interface{}
+	// stopPaths are the field paths that are never copied regardless of the filter.
+	stopPaths map[string]bool
+	// nonFiniteFloatStrings makes StructToMap render NaN and infinite floats as strings.
+	nonFiniteFloatStrings bool
+	// scalarToSlice and sliceToScalar adapt the single src values to the dst slices and vice versa.
+	scalarToSlice bool
+	sliceToScalar bool
+	// noAlias makes the copying functions fail if dst shares any slice or map with src.
+	noAlias bool
+	// presence makes StructToMap omit the fields absent in src.
+	presence bool
+	// protoClone makes StructToStruct copy the messages selected entirely with proto.Clone.
+	protoClone bool
+	// omitProtoDefaults makes StructToMap omit the fields holding the proto3 default values.
+	omitProtoDefaults bool
+	// srcNaming and dstNaming convert the src and dst field names to the names used by the mask.
+	srcNaming Naming
+	dstNaming Naming
+	// dstOneofWrappers are the dst oneof wrapper types registered with WithOneofWrappers.
+	dstOneofWrappers []reflect.Type
+	// iteratorErr receives the error that stopped a StructFieldIterator iteration.
+	iteratorErr *error
+	// tagNames are the struct tags used to resolve the field names, in priority order.
+	tagNames []string
+}
+
+// SliceMerge defines how StructToStruct copies a slice of messages to a dst slice that already has items.
+type SliceMerge int
+
+const (
+	// SliceReplace replaces the dst slice with a new one built from the src items. This is the default.
+	SliceReplace SliceMerge = iota
+	// SliceMergeTruncate merges src[i] into dst[i] where both exist and appends the src items dst does not have.
+	// The dst items beyond the length of src are removed.
+	SliceMergeTruncate
+	// SliceMergeKeep is similar to SliceMergeTruncate but keeps the dst items beyond the length of src.
+	SliceMergeKeep
+)
+
+// WithDstName sets a function that resolves the name of the dst field from the dotted path of the src field
+// (e.g. "avatar.original_url"). It is used by StructToStruct when src and dst fields have different names that can not
+// be expressed with struct tags.
+func WithDstName(f func(srcPath string) (dstName string)) Option {
+	return func(o *options) {
+		o.dstName = f
+	}
+}
+
+// WithErrorOnUnsupported makes StructToStruct and StructToMap return an error when a selected field is of a kind
+// that can not be copied (chan, func or unsafe.Pointer). By default such fields are silently skipped.
+func WithErrorOnUnsupported() Option {
+	return func(o *options) {
+		o.errorOnUnsupported = true
+	}
+}
+
+// WithDefaultMask sets a mask that is used instead of the filter passed to StructToStruct or StructToMap
+// when that filter is an empty Mask. This allows APIs to return a conservative default projection
+// instead of all the fields when the client didn't specify any.
+func WithDefaultMask(m Mask) Option {
+	return func(o *options) {
+		o.defaultMask = m
+	}
+}
+
+// WithTypeFormatter registers a function that converts the values of type `t` before they are put to the
+// StructToMap output (e.g. to render an enum by its name rather than a number).
+// It is also applied to the elements of slices of `t`. The option may be used multiple times for different types.
+func WithTypeFormatter(t reflect.Type, format func(reflect.Value) interface{}) Option {
+	return func(o *options) {
+		if o.typeFormatters == nil {
+			o.typeFormatters = make(map[reflect.Type]func(reflect.Value) interface{})
+		}
+		o.typeFormatters[t] = format
+	}
+}
+
+// WithStringerFormatter registers a type formatter (see WithTypeFormatter) that renders the values of the given
+// types by their String method, e.g. a time.Duration as "1.5s" rather than a number of nanoseconds.
+// The types must implement fmt.Stringer.
+func WithStringerFormatter(types ...reflect.Type) Option {
+	return func(o *options) {
+		for _, t := range types {
+			WithTypeFormatter(t, formatStringer)(o)
+		}
+	}
+}
+
+// WithDurationStrings renders the time.Duration values in StructToMap output as strings, e.g. "1.5s".
+func WithDurationStrings() Option {
+	return WithStringerFormatter(reflect.TypeOf(time.Duration(0)))
+}
+
+func formatStringer(v reflect.Value) interface{} {
+	if stringer, ok := v.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return v.Interface()
+}
+
+// formatter returns the StructToMap formatter of the values of type `t`, if any.
+func (o *options) formatter(t reflect.Type) (func(reflect.Value) interface{}, bool) {
+	format, ok := o.typeFormatters[t]
+	if o.enumNameTransform == nil || !isEnumType(t) {
+		return format, ok
+	}
+	if !ok {
+		format = formatStringer
+	}
+	return func(v reflect.Value) interface{} {
+		result := format(v)
+		if name, ok := result.(string); ok {
+			return o.enumNameTransform(name)
+		}
+		return result
+	}, true
+}
+
+// isEnumType reports whether `t` is a generated proto enum type.
+func isEnumType(t reflect.Type) bool {
+	if t.Kind() != reflect.Int32 || !t.Implements(stringerType) {
+		return false
+	}
+	_, ok := t.MethodByName("EnumDescriptor")
+	return ok
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// WithSliceMerge sets the policy StructToStruct uses when copying slices of messages.
+// It allows updating the selected sub fields of existing dst items instead of replacing them.
+func WithSliceMerge(policy SliceMerge) Option {
+	return func(o *options) {
+		o.sliceMerge = policy
+	}
+}
+
+// WithNativeStructValues makes StructToMap convert google.protobuf.Struct, Value and ListValue fields to native
+// Go values (map[string]interface{}, []interface{}, string, float64, bool or nil) instead of descending into their
+// internal representation. The sub mask of such a field is applied to the Struct keys.
+func WithNativeStructValues() Option {
+	return func(o *options) {
+		o.nativeStructValues = true
+	}
+}
+
+// WithBestEffort makes StructToStruct skip the fields that can not be copied (e.g. due to a type mismatch or a missing
+// dst field) instead of aborting on the first failure. All the errors are returned at the end as a *MultiError.
+func WithBestEffort() Option {
+	return func(o *options) {
+		o.bestEffort = true
+	}
+}
+
+// WithTagNames sets the struct tags that are used to resolve the field names, in priority order.
+// The first tag present on a field defines its name, fields without any of these tags are named after the Go field.
+// The default is "protobuf", "protobuf_oneof", "json", "mapstructure", "bson".
+func WithTagNames(tagNames ...string) Option {
+	return func(o *options) {
+		o.tagNames = tagNames
+	}
+}
+
+// WithNilAsEmptyMap makes StructToMap emit an empty map instead of nil for nil pointers to messages.
+// Unset oneofs (nil interfaces) are still emitted as nil.
+func WithNilAsEmptyMap() Option {
+	return func(o *options) {
+		o.nilAsEmptyMap = true
+	}
+}
+
+// WithRawJSON makes StructToStruct store the JSON encoding of the src field when the dst field is json.RawMessage.
+// Messages are filtered with the corresponding sub mask and encoded the same way StructToMap represents them.
+func WithRawJSON() Option {
+	return func(o *options) {
+		o.rawJSON = true
+	}
+}
+
+// WithErrorOnNilSrc makes StructToStruct and StructToMap return an error when `src` is nil
+// (or a nil pointer). By default dst is left untouched in this case.
+func WithErrorOnNilSrc() Option {
+	return func(o *options) {
+		o.errorOnNilSrc = true
+	}
+}
+
+// WithAtomic makes StructToStruct leave dst unchanged if any error occurs (including the errors collected
+// with WithBestEffort). The copying is done to a shallow copy of dst which replaces dst only on success.
+// Note that items merged in place with WithSliceMerge are shared with that copy and are not protected.
+func WithAtomic() Option {
+	return func(o *options) {
+		o.atomic = true
+	}
+}
+
+// WithEnumValidator registers a function that reports whether a value is valid for the dst type `t`.
+// StructToStruct fails if a value copied to a field of type `t` is not valid. This is useful to verify that an enum
+// converted from a different package is defined in the dst enum, e.g.:
+//
+//	WithEnumValidator(reflect.TypeOf(pb.Role(0)), func(v reflect.Value) bool {
+//		_, ok := pb.Role_name[int32(v.Int())]
+//		return ok
+//	})
+func WithEnumValidator(t reflect.Type, isValid func(reflect.Value) bool) Option {
+	return func(o *options) {
+		if o.enumValidators == nil {
+			o.enumValidators = make(map[reflect.Type]func(reflect.Value) bool)
+		}
+		o.enumValidators[t] = isValid
+	}
+}
+
+// WithFlattenOneof makes StructToMap emit the selected oneof variant directly in the parent map, the same way
+// protobuf JSON does: "name{male_name}" results in {"male_name": "John"} rather than {"name": {"male_name": "John"}}.
+// Unset oneofs are omitted.
+func WithFlattenOneof() Option {
+	return func(o *options) {
+		o.flattenOneof = true
+	}
+}
+
+// WithStrictTypes makes StructToStruct fail on any type mismatch instead of converting the values of distinct
+// types with the same underlying kind (e.g. enums generated in different packages). There is no package-wide switch
+// on purpose: the options are per call, so that a global setting can not change the behavior of the other libraries
+// using this package in the same program. Wrap the copying functions to make the strict types the default.
+func WithStrictTypes() Option {
+	return func(o *options) {
+		o.strictTypes = true
+	}
+}
+
+// WithMapEntryAdapter makes StructToStruct copy the src field at the dotted `path` (e.g. "labels"), a slice of
+// key/value entry messages such as []*LabelsEntry, to a dst map field. The entries must have Key and Value fields.
+// The option may be passed several times for different paths.
+func WithMapEntryAdapter(path string) Option {
+	return func(o *options) {
+		if o.mapEntryPaths == nil {
+			o.mapEntryPaths = make(map[string]bool)
+		}
+		o.mapEntryPaths[path] = true
+	}
+}
+
+// WithUnwrapOneof makes StructToStruct copy the fields of the selected oneof variant directly to dst if dst does
+// not have the oneof field itself, e.g. "name{male_name}" is copied to the MaleName field of a flat dst struct.
+func WithUnwrapOneof() Option {
+	return func(o *options) {
+		o.unwrapOneof = true
+	}
+}
+
+// WithProtoJSONNames makes the copying functions use the JSON names of the protobuf fields (the `json=` part of the
+// `protobuf` tag, e.g. "originalUrl") instead of the original field names, so masks written in proto JSON names
+// are applied without a Naming function. The dst fields are resolved by both names.
+func WithProtoJSONNames() Option {
+	return func(o *options) {
+		o.protoJSONNames = true
+	}
+}
+
+// EmptySlices defines how StructToStruct copies nil and empty src slices.
+type EmptySlices int
+
+const (
+	// EmptySlicesPreserve copies a nil slice as a nil slice and an empty slice as an empty one. This is the default.
+	EmptySlicesPreserve EmptySlices = iota
+	// EmptySlicesAsNil copies both nil and empty slices as nil slices.
+	EmptySlicesAsNil
+	// EmptySlicesAsEmpty copies both nil and empty slices as empty non-nil slices.
+	EmptySlicesAsEmpty
+)
+
+// WithEmptySlices sets how StructToStruct copies nil and empty slices. See EmptySlices.
+func WithEmptySlices(policy EmptySlices) Option {
+	return func(o *options) {
+		o.emptySlices = policy
+	}
+}
+
+// WithGetters makes the copying functions read the src fields through their getter methods (e.g. GetUsername for
+// the Username or username field) where such methods exist. This allows copying from the types that only expose
+// their fields through getters: unexported src fields are copied if they have a getter.
+func WithGetters() Option {
+	return func(o *options) {
+		o.getters = true
+	}
+}
+
+// WithResetDst makes StructToStruct zero the whole dst before copying, so that the fields not selected by the filter
+// do not keep the values from the previous copies when dst is reused.
+func WithResetDst() Option {
+	return func(o *options) {
+		o.resetDst = true
+	}
+}
+
+// WithLogger sets a function that receives a message for each decision the copying functions make about a field:
+// whether it is copied or skipped, and when a nested message is entered. The messages contain the dotted field paths.
+func WithLogger(logger func(format string, args ...interface{})) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithErrorOnArrayOverflow makes StructToStruct return an error if a src slice is longer than the fixed size dst
+// array it is copied to. By default the items that do not fit are ignored.
+func WithErrorOnArrayOverflow() Option {
+	return func(o *options) {
+		o.errorOnArrayOverflow = true
+	}
+}
+
+// WithSortedMapEntries makes StructToMap emit the map fields as []KeyValue sorted by key instead of maps, so that
+// the order of the keys is deterministic, e.g. when the result is encoded to JSON.
+func WithSortedMapEntries() Option {
+	return func(o *options) {
+		o.sortedMapEntries = true
+	}
+}
+
+// WithKeyRenames makes StructToMap use different keys for the fields at the given dotted paths, e.g.
+// {"avatar.original_url": "url"} puts the original URL of the avatar to the "url" key of the avatar map.
+// The other keys, including those of the siblings and the sub fields of the renamed field, are not affected.
+func WithKeyRenames(renames map[string]string) Option {
+	return func(o *options) {
+		o.keyRenames = renames
+	}
+}
+
+// WithOpaqueTypes registers the types that the copying functions treat as leaves: the values of these types (or
+// pointers to them) are copied as is instead of being descended into, regardless of the sub mask.
+// The gogoproto.customtype types (those implementing Marshal, MarshalTo, Unmarshal and Size that are not messages)
+// are always treated as opaque.
+func WithOpaqueTypes(types ...reflect.Type) Option {
+	return func(o *options) {
+		if o.opaqueTypes == nil {
+			o.opaqueTypes = make(map[reflect.Type]bool)
+		}
+		for _, t := range types {
+			o.opaqueTypes[t] = true
+		}
+	}
+}
+
+// WithAdapter registers a function that StructToStruct uses to convert the src fields of type `srcType` to the dst
+// fields of type `dstType`, e.g. a string to a sql.NullString. The function must return a value assignable to
+// `dstType`. The option may be passed several times for different pairs of types.
+func WithAdapter(srcType, dstType reflect.Type, adapt func(src reflect.Value) (reflect.Value, error)) Option {
+	return func(o *options) {
+		if o.adapters == nil {
+			o.adapters = make(map[adapterKey]func(reflect.Value) (reflect.Value, error))
+		}
+		o.adapters[adapterKey{src: srcType, dst: dstType}] = adapt
+	}
+}
+
+type adapterKey struct {
+	src, dst reflect.Type
+}
+
+// WithRequireFullCoverage makes StructToStruct and StructToMap return an error after copying if any of the src
+// fields was skipped because the filter did not select it. This is useful in tests to make sure a mask covers all
+// the fields of a message, e.g. when new fields are added to the schema.
+func WithRequireFullCoverage() Option {
+	return func(o *options) {
+		o.requireFullCoverage = true
+	}
+}
+
+// WithStringTransform applies `transform` to every copied string scalar, including the items of the string slices,
+// e.g. to trim whitespace or to lowercase the values. The strings in maps are copied as is.
+func WithStringTransform(transform func(string) string) Option {
+	return func(o *options) {
+		o.stringTransform = transform
+	}
+}
+
+// WithMatchByFieldNumber makes StructToStruct map the src fields to the dst fields by their protobuf field numbers
+// (parsed from the `protobuf` tags) rather than by their names, so that the copies survive the fields being renamed
+// in a newer version of the schema. The mask paths refer to the src field names. The fields without a protobuf
+// field number are still matched by name.
+func WithMatchByFieldNumber() Option {
+	return func(o *options) {
+		o.matchByFieldNumber = true
+	}
+}
+
+// WithEnumNameTransform makes StructToMap render the proto enum values by their names with `transform` applied,
+// e.g. WithEnumNameTransform(strings.ToLower) renders Role_ADMIN as "admin". If a type formatter is registered for
+// the enum type (see WithTypeFormatter), `transform` is applied to the string it returns.
+func WithEnumNameTransform(transform func(string) string) Option {
+	return func(o *options) {
+		o.enumNameTransform = transform
+	}
+}
+
+// WithNilShape makes StructToMap preserve the shape of the output for nil messages selected by a nested mask:
+// with the mask "avatar{original_url}" a nil avatar results in {"avatar": {"original_url": nil}} rather than
+// {"avatar": nil}, so that the output has the same keys whether or not the message is present.
+// The nil messages selected entirely are still emitted as nil (or as empty maps with WithNilAsEmptyMap).
+func WithNilShape() Option {
+	return func(o *options) {
+		o.nilShape = true
+	}
+}
+
+// WithDefaults makes StructToStruct and StructToMap copy the given default values instead of the src values that
+// are zero (e.g. an empty string or a nil message). The defaults are keyed by the dotted field paths, e.g.
+// "avatar.original_url", and must be of the src field type, a number for a numeric field or a value of the same kind
+// convertible to the field type (e.g. a string for a string based enum).
+func WithDefaults(defaults map[string]interface{}) Option {
+	return func(o *options) {
+		o.defaults = defaults
+	}
+}
+
+// WithStopPaths makes the copying functions skip the fields at the given dotted paths (e.g. "internal" or
+// "friends.internal") with everything under them even if the filter selects them, e.g. with the mask
+// "internal{secret}". This is a redaction control that does not depend on the mask provided by the caller.
+func WithStopPaths(paths ...string) Option {
+	return func(o *options) {
+		if o.stopPaths == nil {
+			o.stopPaths = make(map[string]bool, len(paths))
+		}
+		for _, path := range paths {
+			o.stopPaths[path] = true
+		}
+	}
+}
+
+// WithNonFiniteFloatStrings makes StructToMap render the NaN and infinite float values as the "NaN", "Infinity" and
+// "-Infinity" strings, the same way jsonpb does, so that the result can be passed to json.Marshal.
+// A slice of floats having such values is rendered as []interface{}.
+func WithNonFiniteFloatStrings() Option {
+	return func(o *options) {
+		o.nonFiniteFloatStrings = true
+	}
+}
+
+// WithScalarToSlice makes StructToStruct copy a single src value (e.g. an *Image) to a dst slice field
+// (e.g. []*Image) as a one-element slice. A nil src results in a nil dst slice.
+func WithScalarToSlice() Option {
+	return func(o *options) {
+		o.scalarToSlice = true
+	}
+}
+
+// WithSliceToScalar makes StructToStruct copy the first item of a src slice or array to a dst field that is
+// neither a slice nor an array. An empty src results in a zero dst value.
+func WithSliceToScalar() Option {
+	return func(o *options) {
+		o.sliceToScalar = true
+	}
+}
+
+// WithNoAlias makes StructToStruct and StructToMap fail after copying if any slice or map in dst shares its backing
+// array or map with src (e.g. the slices of scalars are copied as is), so that tests catch the unintended shared
+// references. The check walks both src and dst entirely and is meant for debugging.
+func WithNoAlias() Option {
+	return func(o *options) {
+		o.noAlias = true
+	}
+}
+
+// WithPresenceMap makes StructToMap and StructToJSONStream omit the fields absent in src: nil messages, unset proto3
+// optional fields (nil scalar pointers) and unset oneofs. The present fields are emitted even if they hold zero
+// values, so that a key in the result means the field was set, e.g. for PATCH requests. The absent fields are omitted
+// even with WithNilShape or WithNilAsEmptyMap.
+func WithPresenceMap() Option {
+	return func(o *options) {
+		o.presence = true
+	}
+}
+
+// WithProtoCloneForFullSubtrees makes StructToStruct copy the messages selected with an empty sub mask (the message
+// fields and the items of the repeated message fields) with proto.Clone rather than field by field when src and dst
+// are of the same proto.Message type. This is faster and also preserves the unknown fields. The options affecting the
+// nested fields (e.g. WithStringTransform or WithStopPaths) are not applied to the cloned messages.
+func WithProtoCloneForFullSubtrees() Option {
+	return func(o *options) {
+		o.protoClone = true
+	}
+}
+
+// WithOmitProtoDefaults makes StructToMap and StructToJSONStream omit the fields holding their proto3 default values,
+// the same way jsonpb does without EmitDefaults: zero scalars and enums, empty strings, bytes, repeated fields and
+// maps, nil messages and unset oneofs. Like in jsonpb, the set proto3 optional fields (scalar pointers) and
+// the oneof variants are emitted even if they hold zero values, see also WithPresenceMap.
+func WithOmitProtoDefaults() Option {
+	return func(o *options) {
+		o.omitProtoDefaults = true
+	}
+}
+
+// WithSrcNaming applies `naming` to the src field names resolved from the struct tags (or to the Go field names of
+// the fields without tags), so that a mask written in a different convention matches them. The StructToMap keys are
+// the converted names. Use with WithDstNaming when src, dst and the mask use three distinct conventions, e.g. Go
+// field names, snake_case json tags and a lowerCamelCase mask.
+func WithSrcNaming(naming Naming) Option {
+	return func(o *options) {
+		o.srcNaming = naming
+	}
+}
+
+// WithDstNaming applies `naming` to the dst field names resolved from the struct tags, so that StructToStruct
+// matches them with the src field names converted by WithSrcNaming (or with the mask names).
+func WithDstNaming(naming Naming) Option {
+	return func(o *options) {
+		o.dstNaming = naming
+	}
+}
+
+func newOptions(opts []interface{}) *options {
+	o := &options{tagNames: defaultTagNames}
+	for _, opt := range opts {
+		if opt, ok := opt.(Option); ok {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// rootFilter returns the filter the copying should start with.
+func (o *options) rootFilter(filter FieldFilter) FieldFilter {
+	if mask, ok := filter.(Mask); ok && len(mask) == 0 && len(o.defaultMask) > 0 {
+		return o.defaultMask
+	}
+	return filter
+}
+
+// collectedErrors returns the errors recorded in the best effort mode, if any.
+func (o *options) collectedErrors() error {
+	if len(o.errors) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: o.errors}
+}
+
+func (o *options) nilSrcError() error {
+	if o.errorOnNilSrc {
+		return errors.New("src must not be nil")
+	}
+	return nil
+}
+
+// normalizeEmptySlice applies the EmptySlices policy to the copied slice `v`.
+func (o *options) normalizeEmptySlice(v reflect.Value) {
+	if v.Kind() != reflect.Slice || v.Len() > 0 {
+		return
+	}
+	switch {
+	case o.emptySlices == EmptySlicesAsNil && !v.IsNil():
+		v.Set(reflect.Zero(v.Type()))
+	case o.emptySlices == EmptySlicesAsEmpty && v.IsNil():
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	}
+}
+
+// arrayOverflowError returns an error if WithErrorOnArrayOverflow is used and `src` does not fit in the `dst` array.
+func (o *options) arrayOverflowError(src, dst reflect.Value, fieldPath string) error {
+	if o.errorOnArrayOverflow && src.Len() > dst.Len() {
+		return errors.Errorf("field %s has %d items that do not fit in %s", fieldPath, src.Len(), dst.Type())
+	}
+	return nil
+}
+
+// isOpaque reports whether the values of type `t` are copied as is, see WithOpaqueTypes.
+func (o *options) isOpaque(t reflect.Type) bool {
+	if o.opaqueTypes[t] || o.opaqueTypes[indirectType(t)] {
+		return true
+	}
+	return indirectType(t).Kind() == reflect.Struct && (isCustomType(t) || isFieldMaskType(t))
+}
+
+// transformStrings returns `v` with the WithStringTransform transform applied if `v` is a string or a slice or
+// an array of strings. Other values are returned as is.
+func (o *options) transformStrings(v reflect.Value) reflect.Value {
+	if o.stringTransform == nil {
+		return v
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		return reflect.ValueOf(o.stringTransform(v.String())).Convert(v.Type())
+
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() == reflect.String:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return v
+		}
+		result := reflect.New(v.Type()).Elem()
+		if v.Kind() == reflect.Slice {
+			result = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		}
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(reflect.ValueOf(o.stringTransform(v.Index(i).String())).Convert(v.Type().Elem()))
+		}
+		return result
+	}
+	return v
+}
+
+// applyDefault returns the WithDefaults value of the field at `fieldPath` if `srcField` is zero.
+func (o *options) applyDefault(srcField reflect.Value, fieldPath string) (reflect.Value, error) {
+	value, ok := o.defaults[fieldPath]
+	if !ok || !srcField.IsZero() {
+		return srcField, nil
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case !v.IsValid():
+		return srcField, nil
+	case v.Type().AssignableTo(srcField.Type()):
+		return v, nil
+	case v.Type().ConvertibleTo(srcField.Type()) &&
+		(v.Kind() == srcField.Kind() || isNumericKind(v.Kind()) && isNumericKind(srcField.Kind())):
+		// Only the numbers and the values of the same kind are converted: Convert would turn an int to a string
+		// holding the rune with that code point.
+		return v.Convert(srcField.Type()), nil
+	}
+	return reflect.Value{}, errors.Errorf("default value of type %s can not be used for the field %s of type %s",
+		v.Type(), fieldPath, srcField.Type())
+}
+
+// isNumericKind reports whether the values of the given kind are integers or floats.
+func isNumericKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// mapValue returns the StructToMap representation of the scalar (or a slice of scalars) `v`.
+func (o *options) mapValue(v reflect.Value) interface{} {
+	v = o.transformStrings(v)
+	if !o.nonFiniteFloatStrings {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if s, ok := nonFiniteFloatString(v.Float()); ok {
+			return s
+		}
+
+	case reflect.Slice, reflect.Array:
+		kind := v.Type().Elem().Kind()
+		if kind != reflect.Float32 && kind != reflect.Float64 {
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			if _, ok := nonFiniteFloatString(v.Index(i).Float()); !ok {
+				continue
+			}
+			items := make([]interface{}, v.Len())
+			for j := range items {
+				items[j] = o.mapValue(v.Index(j))
+			}
+			return items
+		}
+	}
+	return v.Interface()
+}
+
+// nonFiniteFloatString returns the jsonpb representation of the NaN and infinite values.
+func nonFiniteFloatString(f float64) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "NaN", true
+	case math.IsInf(f, 1):
+		return "Infinity", true
+	case math.IsInf(f, -1):
+		return "-Infinity", true
+	}
+	return "", false
+}
+
+// absent reports whether the `srcField` value of the `field` struct field must be omitted from the StructToMap
+// output because it is not present in src or holds the proto3 default value.
+func (o *options) absent(field reflect.StructField, srcField reflect.Value) bool {
+	switch srcField.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return (o.presence || o.omitProtoDefaults) && srcField.IsNil()
+	case reflect.Slice, reflect.Map:
+		return o.omitProtoDefaults && srcField.Len() == 0
+	case reflect.Struct, reflect.Array:
+		return false
+	}
+	// The oneof variants are present whatever their values are.
+	return o.omitProtoDefaults && srcField.IsZero() && !strings.HasSuffix(field.Tag.Get("protobuf"), ",oneof")
+}
+
+// protoCloneOf returns a proto.Clone copy of `src` if WithProtoCloneForFullSubtrees is used, `filter` selects the
+// whole message and `src` is a non-nil proto.Message of the `dstType` type.
+func (o *options) protoCloneOf(filter FieldFilter, src reflect.Value, dstType reflect.Type) (reflect.Value, bool) {
+	if !o.protoClone || src.Type() != dstType || src.Kind() != reflect.Ptr || src.IsNil() || !selectsAll(filter) {
+		return reflect.Value{}, false
+	}
+	msg, ok := src.Interface().(proto.Message)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(proto.Clone(msg)), true
+}
+
+// skip records that the field at `fieldPath` is not selected by the filter.
+func (o *options) skip(fieldPath string) {
+	if o.logger != nil {
+		o.logger("skipping %s: not selected by the filter", fieldPath)
+	}
+	if o.requireFullCoverage {
+		o.uncovered = append(o.uncovered, fieldPath)
+	}
+}
+
+// coverageError returns an error listing the fields skipped in the WithRequireFullCoverage mode, if any.
+func (o *options) coverageError() error {
+	if len(o.uncovered) == 0 {
+		return nil
+	}
+	return errors.Errorf("fields %s are not covered by the filter", strings.Join(o.uncovered, ", "))
+}
+
+func joinPath(path, fieldName string) string {
+	if path == "" {
+		return fieldName
+	}
+	return path + "." + fieldName
+}
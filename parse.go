@@ -0,0 +1,160 @@
+package fieldmask_utils
+
+import "fmt"
+
+// ParseError is returned by ParseMask for invalid mask strings.
+type ParseError struct {
+	// Pos is the index of the rune in the input string where the parsing failed.
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid mask at position %d: %s", e.Pos, e.Msg)
+}
+
+// ParseMask creates a `Mask` from a string `s` like "a,b,c{d,e{f,g}},d".
+// This is the same string format as in MaskFromString, but unlike MaskFromString the input is validated,
+// so it is safe to use with user provided strings. Errors are of the *ParseError type.
+// The recursive wildcard "**" selects all the fields of its level with all their descendants, the fields listed next
+// to it keep their own sub masks: "a{b{c},**}" selects all the fields of `a`, but only `c` of `a.b`.
+func ParseMask(s string) (Mask, error) {
+	p := &maskParser{runes: []rune(s)}
+	return p.parseList(-1)
+}
+
+// MaskFromStringWithNaming is like ParseMask, but applies `naming` to every field name, e.g. to write the mask
+// in snake_case and match the Go field names.
+func MaskFromStringWithNaming(s string, naming Naming) (Mask, error) {
+	p := &maskParser{runes: []rune(s), naming: naming}
+	return p.parseList(-1)
+}
+
+type maskParser struct {
+	runes  []rune
+	pos    int
+	naming Naming
+}
+
+func (p *maskParser) error(pos int, format string, args ...interface{}) error {
+	return &ParseError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *maskParser) skipSpaces() {
+	for p.pos < len(p.runes) {
+		switch p.runes[p.pos] {
+		case ' ', '\n', '\t', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *maskParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.runes) {
+		switch p.runes[p.pos] {
+		case ' ', '\n', '\t', '\r', ',', '{', '}':
+			return string(p.runes[start:p.pos])
+		}
+		p.pos++
+	}
+	return string(p.runes[start:p.pos])
+}
+
+// parseList parses a comma separated list of fields.
+// `openPos` is the position of the opening brace of a nested list or -1 for the top level list.
+func (p *maskParser) parseList(openPos int) (Mask, error) {
+	mask := make(Mask)
+	nested := openPos >= 0
+
+	p.skipSpaces()
+	if p.pos == len(p.runes) {
+		if nested {
+			return nil, p.error(openPos, "unclosed brace")
+		}
+		return mask, nil
+	}
+	if nested && p.runes[p.pos] == '}' {
+		// Empty braces are allowed and have the same meaning as no braces.
+		p.pos++
+		return mask, nil
+	}
+
+	for {
+		p.skipSpaces()
+		namePos := p.pos
+		fieldName := p.parseName()
+		if fieldName == "" {
+			if p.pos == len(p.runes) {
+				return nil, p.error(namePos, "empty field name at the end of the input")
+			}
+			return nil, p.error(namePos, "empty field name before %q", p.runes[p.pos])
+		}
+		if p.naming != nil && fieldName != recursiveWildcard {
+			fieldName = p.naming(fieldName)
+		}
+
+		p.skipSpaces()
+		subMask := make(Mask)
+		if p.pos < len(p.runes) && p.runes[p.pos] == '{' {
+			bracePos := p.pos
+			if fieldName == recursiveWildcard {
+				return nil, p.error(bracePos, "the recursive wildcard %s can not have sub fields", recursiveWildcard)
+			}
+			p.pos++
+			var err error
+			if subMask, err = p.parseList(bracePos); err != nil {
+				return nil, err
+			}
+		}
+		// The field may be mentioned more than once: its sub masks are merged.
+		mergeField(mask, fieldName, subMask)
+
+		p.skipSpaces()
+		if p.pos == len(p.runes) {
+			if nested {
+				return nil, p.error(openPos, "unclosed brace")
+			}
+			return mask, nil
+		}
+
+		switch p.runes[p.pos] {
+		case ',':
+			p.pos++
+
+		case '}':
+			if !nested {
+				return nil, p.error(p.pos, "unexpected closing brace")
+			}
+			p.pos++
+			return mask, nil
+
+		default:
+			return nil, p.error(p.pos, "unexpected %q after field name %q", p.runes[p.pos], fieldName)
+		}
+	}
+}
+
+// mergeMasks adds the fields of `src` to `dst`.
+func mergeMasks(dst, src Mask) {
+	for fieldName, subFilter := range src {
+		mergeField(dst, fieldName, subFilter)
+	}
+}
+
+// mergeField adds the field `fieldName` with the sub filter `subFilter` to `dst`. The larger scope wins: a field that
+// is selected entirely by either side stays selected entirely.
+func mergeField(dst Mask, fieldName string, subFilter FieldFilter) {
+	existing, ok := dst[fieldName].(Mask)
+	sub, isMask := subFilter.(Mask)
+	switch {
+	case ok && isMask && len(existing) == 0:
+		// The field is already selected entirely.
+	case ok && isMask && len(sub) > 0:
+		mergeMasks(existing, sub)
+	default:
+		dst[fieldName] = subFilter
+	}
+}
@@ -0,0 +1,39 @@
+//go:build go1.18
+// +build go1.18
+
+package fieldmask_utils_test
+
+import (
+	"testing"
+
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func FuzzParseMask(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"a,b,c{d,e{f,g}},d",
+		"foo, bar{c {d,e{f,\ng,h}}},t",
+		"a{**},b",
+		"a{",
+		"}",
+		"{a}",
+		"a{,b}}",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		// MaskFromString does not validate the input, but must not panic.
+		fieldmask_utils.MaskFromString(s)
+
+		mask, err := fieldmask_utils.ParseMask(s)
+		if err != nil {
+			return
+		}
+		reparsed, err := fieldmask_utils.ParseMask(mask.String())
+		require.NoError(t, err, mask.String())
+		assert.Equal(t, mask, reparsed)
+	})
+}
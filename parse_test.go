@@ -0,0 +1,87 @@
+package fieldmask_utils_test
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/generator"
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMask(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"  ", ""},
+		{"foo", "foo"},
+		{"foo,bar{c{d,e{f,g,h}}}", "foo,bar{c{d,e{f,g,h}}}"},
+		{"foo, bar{c {d,e{f,\ng,h}}},t", "foo,bar{c{d,e{f,g,h}}},t"},
+		{"foo{}", "foo"},
+		{"a{b},a{c}", "a{b,c}"},
+		{"a,a{b}", "a"},
+		{"a{b},a", "a"},
+		{"a{},a{b}", "a"},
+		{"a{b{c}},a{b}", "a{b}"},
+		{"a{**},b{c{**}}", "a{**},b{c{**}}"},
+	}
+	for _, testCase := range testCases {
+		mask, err := fieldmask_utils.ParseMask(testCase.input)
+		require.NoError(t, err, testCase.input)
+		assert.Equal(t, fieldmask_utils.MaskFromString(testCase.expected), mask, testCase.input)
+	}
+}
+
+func TestParseMaskError(t *testing.T) {
+	testCases := []struct {
+		input string
+		pos   int
+	}{
+		{"a{", 1},
+		{"a{b{c}", 1},
+		{"a{b,c{d}", 1},
+		{"}", 0},
+		{"a}", 1},
+		{"a,,b", 2},
+		{"a,", 2},
+		{",a", 0},
+		{"{a}", 0},
+		{"a{,b}", 2},
+		{"a b", 2},
+		{"a{b}c", 4},
+		{"a{**{b}}", 4},
+	}
+	for _, testCase := range testCases {
+		_, err := fieldmask_utils.ParseMask(testCase.input)
+		require.Error(t, err, testCase.input)
+		require.IsType(t, &fieldmask_utils.ParseError{}, err, testCase.input)
+		assert.Equal(t, testCase.pos, err.(*fieldmask_utils.ParseError).Pos, testCase.input)
+	}
+}
+
+func TestMaskFromStringWithNaming(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromStringWithNaming("id,avatar{original_url},name{male_name}", generator.CamelCase)
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("Id,Avatar{OriginalUrl},Name{MaleName}"), mask)
+
+	type User struct {
+		Id       uint32
+		MaleName string
+		Username string
+	}
+	userDst := &User{}
+	err = fieldmask_utils.StructToStruct(mask, &User{Id: 1, MaleName: "John", Username: "johnny"}, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 1}, userDst)
+
+	mask, err = fieldmask_utils.MaskFromStringWithNaming("male_name", generator.CamelCase)
+	require.NoError(t, err)
+	err = fieldmask_utils.StructToStruct(mask, &User{Id: 1, MaleName: "John"}, userDst)
+	require.NoError(t, err)
+	assert.Equal(t, "John", userDst.MaleName)
+
+	_, err = fieldmask_utils.MaskFromStringWithNaming("a{", generator.CamelCase)
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StructToStructWithPathMap populates the fields of `dst` from the values found at the dotted paths of `src`.
+// `paths` maps the dst field names to the src paths, e.g. {"friend_username": "friends.0.username"}.
+// Both dst field names and path segments are resolved using the struct tags, the same way as in StructToStruct.
+// Numeric path segments index repeated fields. A nil message on the path results in a zero dst field.
+// The messages, slices and maps are deep copied, so dst never shares the memory with src.
+func StructToStructWithPathMap(paths map[string]string, src, dst interface{}, opts ...interface{}) error {
+	o := newOptions(opts)
+	dstVal := indirect(reflect.ValueOf(dst))
+	if dstVal.Kind() != reflect.Struct {
+		return errors.Errorf("dst must be a pointer to a struct, got %T", dst)
+	}
+	dstFields := o.dstFieldMapping(dstVal)
+
+	// Resolve the fields in a stable order, so that the same error is reported for the same paths.
+	dstFieldNames := make([]string, 0, len(paths))
+	for dstFieldName := range paths {
+		dstFieldNames = append(dstFieldNames, dstFieldName)
+	}
+	sort.Strings(dstFieldNames)
+
+	for _, dstFieldName := range dstFieldNames {
+		srcPath := paths[dstFieldName]
+		goFieldName, ok := dstFields[dstFieldName]
+		if !ok {
+			return errors.Errorf("target field %s is not present in dst struct", dstFieldName)
+		}
+		dstField := dstVal.FieldByName(goFieldName)
+		if !dstField.CanSet() {
+			return errors.Errorf("can't set a value on a field %s", dstFieldName)
+		}
+
+		srcValue, err := valueAtPath(reflect.ValueOf(src), srcPath, o)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !srcValue.IsValid():
+			dstField.Set(reflect.Zero(dstField.Type()))
+
+		case indirect(srcValue).Kind() == reflect.Struct && dstField.Kind() == reflect.Ptr &&
+			dstField.Type().Elem().Kind() == reflect.Struct:
+			v := reflect.New(dstField.Type().Elem())
+			if err := StructToStruct(Mask{}, srcValue.Interface(), v.Interface(), opts...); err != nil {
+				return errors.Wrapf(err, "failed to copy %s to %s", srcPath, dstFieldName)
+			}
+			dstField.Set(v)
+
+		case srcValue.Type().AssignableTo(dstField.Type()):
+			// The slices and maps are copied so that dst does not share the memory with src.
+			v, err := cloneValue(srcValue, opts)
+			if err != nil {
+				return errors.Wrapf(err, "failed to copy %s to %s", srcPath, dstFieldName)
+			}
+			dstField.Set(v)
+
+		default:
+			return typeMismatchError(srcPath, srcValue.Type(), dstField.Type())
+		}
+	}
+	return nil
+}
+
+// cloneValue returns a deep copy of the slices, maps and messages in `v`. Other values are returned as is.
+func cloneValue(v reflect.Value, opts []interface{}) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return v, nil
+		}
+		clone := reflect.New(v.Type().Elem())
+		if err := StructToStruct(Mask{}, v.Interface(), clone.Interface(), opts...); err != nil {
+			return reflect.Value{}, err
+		}
+		return clone, nil
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, nil
+		}
+		return cloneValue(v.Elem(), opts)
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v, nil
+		}
+		clone := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := cloneValue(v.Index(i), opts)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			clone.Index(i).Set(item)
+		}
+		return clone, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v, nil
+		}
+		clone := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			value, err := cloneValue(v.MapIndex(key), opts)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			clone.SetMapIndex(key, value)
+		}
+		return clone, nil
+	}
+	return v, nil
+}
+
+// valueAtPath returns the value found at the dotted `path` in `val`.
+// An invalid value is returned if a nil pointer is found on the path.
+func valueAtPath(val reflect.Value, path string, o *options) (reflect.Value, error) {
+	for _, segment := range strings.Split(path, ".") {
+		for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+			if val.IsNil() {
+				return reflect.Value{}, nil
+			}
+			val = val.Elem()
+		}
+
+		switch val.Kind() {
+		case reflect.Struct:
+			goFieldName, ok := o.fieldMapping(val, true)[segment]
+			if !ok {
+				return reflect.Value{}, errors.Errorf("no such field: %s in path %s", segment, path)
+			}
+			val = val.FieldByName(goFieldName)
+
+		case reflect.Slice, reflect.Array:
+			index, err := strconv.Atoi(segment)
+			if err != nil {
+				return reflect.Value{}, errors.Errorf("invalid index %s in path %s", segment, path)
+			}
+			if index < 0 || index >= val.Len() {
+				return reflect.Value{}, errors.Errorf("index %d is out of range in path %s", index, path)
+			}
+			val = val.Index(index)
+
+		case reflect.Map:
+			if val.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, errors.Errorf("unsupported map key type %s in path %s", val.Type().Key(), path)
+			}
+			val = val.MapIndex(reflect.ValueOf(segment).Convert(val.Type().Key()))
+			if !val.IsValid() {
+				return reflect.Value{}, nil
+			}
+
+		default:
+			return reflect.Value{}, errors.Errorf("can't resolve %s in path %s: %s is not a message", segment, path,
+				val.Type())
+		}
+	}
+	return val, nil
+}
@@ -0,0 +1,122 @@
+package fieldmask_utils_test
+
+import (
+	"testing"
+
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructToStructWithPathMap(t *testing.T) {
+	type UserDTO struct {
+		Id                   uint32
+		FriendUsername       string
+		FriendSecondImageUrl string
+		AvatarUrl            string `json:"avatar_url"`
+		Meta                 string
+	}
+
+	dst := &UserDTO{}
+	err := fieldmask_utils.StructToStructWithPathMap(map[string]string{
+		"Id":                   "id",
+		"FriendUsername":       "friends.0.username",
+		"FriendSecondImageUrl": "friends.0.images.1.original_url",
+		"avatar_url":           "avatar.resized_url",
+		"Meta":                 "meta.foo",
+	}, testUserFull, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &UserDTO{
+		Id:                   testUserFull.Id,
+		FriendUsername:       testUserFull.Friends[0].Username,
+		FriendSecondImageUrl: testUserFull.Friends[0].Images[1].OriginalUrl,
+		AvatarUrl:            testUserFull.Avatar.ResizedUrl,
+		Meta:                 testUserFull.Meta["foo"],
+	}, dst)
+}
+
+func TestStructToStructWithPathMapNilMessage(t *testing.T) {
+	type UserDTO struct {
+		AvatarUrl string
+		Avatar    *testproto.Image
+	}
+	dst := &UserDTO{AvatarUrl: "stale", Avatar: &testproto.Image{}}
+	err := fieldmask_utils.StructToStructWithPathMap(map[string]string{
+		"AvatarUrl": "avatar.original_url",
+		"Avatar":    "avatar",
+	}, testUserPartial, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &UserDTO{}, dst)
+}
+
+func TestStructToStructWithPathMapFail(t *testing.T) {
+	type UserDTO struct {
+		Username int
+		Name     string
+	}
+	testCases := []map[string]string{
+		{"Unknown": "id"},
+		{"Name": "unknown"},
+		{"Name": "friends.5.username"},
+		{"Name": "friends.first.username"},
+		{"Name": "id.foo"},
+		{"Username": "username"},
+	}
+	for _, paths := range testCases {
+		err := fieldmask_utils.StructToStructWithPathMap(paths, testUserFull, &UserDTO{})
+		assert.Error(t, err, paths)
+	}
+}
+
+func TestStructToStructWithPathMapDeepCopy(t *testing.T) {
+	type UserDTO struct {
+		Friend *testproto.User
+		Tags   []string
+		Meta   map[string]string
+		Images []*testproto.Image
+	}
+	dst := &UserDTO{}
+	err := fieldmask_utils.StructToStructWithPathMap(map[string]string{
+		"Friend": "friends.0",
+		"Tags":   "tags",
+		"Meta":   "meta",
+		"Images": "images",
+	}, testUserFull, dst)
+	require.NoError(t, err)
+	assert.Equal(t, testUserFull.Friends[0], dst.Friend)
+	assert.Equal(t, testUserFull.Tags, dst.Tags)
+	assert.Equal(t, testUserFull.Meta, dst.Meta)
+	assert.Equal(t, testUserFull.Images, dst.Images)
+
+	// dst does not share the memory with src.
+	assert.False(t, testUserFull.Friends[0] == dst.Friend)
+	assert.False(t, &testUserFull.Tags[0] == &dst.Tags[0])
+	assert.False(t, testUserFull.Images[0] == dst.Images[0])
+	dst.Meta["foo"] = "changed"
+	assert.Equal(t, "bar", testUserFull.Meta["foo"])
+}
+
+func TestStructToStructWithPathMapNaming(t *testing.T) {
+	type UserDTO struct {
+		AvatarUrl string
+	}
+	dst := &UserDTO{}
+	err := fieldmask_utils.StructToStructWithPathMap(map[string]string{"AvatarUrl": "avatar.originalUrl"},
+		testUserFull, dst, fieldmask_utils.WithProtoJSONNames())
+	require.NoError(t, err)
+	assert.Equal(t, testUserFull.Avatar.OriginalUrl, dst.AvatarUrl)
+}
+
+func TestStructToStructWithPathMapErrorOrder(t *testing.T) {
+	type UserDTO struct {
+		A string
+		B string
+	}
+	paths := map[string]string{"A": "bogus_a", "B": "bogus_b"}
+	for i := 0; i < 10; i++ {
+		err := fieldmask_utils.StructToStructWithPathMap(paths, testUserFull, &UserDTO{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bogus_a")
+	}
+}
@@ -0,0 +1,151 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMaxDepth is the depth AllPaths uses unless MaxDepth is given.
+const defaultMaxDepth = 5
+
+// AllPaths returns the dotted paths of all the leaf fields of the message type `t` in the order of declaration,
+// e.g. "id", "avatar.original_url", "name.male_name". The field names are resolved from the tags the same way the
+// copying functions do, `opts` may contain a Naming function that is applied to them.
+// Nested messages are descended into up to MaxDepth levels (5 by default): the messages at the last level are
+// listed as leaves, so recursive types like a User with friends are handled.
+func AllPaths(t reflect.Type, opts ...interface{}) []string {
+	var (
+		naming   = func(name string) string { return name }
+		maxDepth = defaultMaxDepth
+	)
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case Naming:
+			naming = opt
+
+		case MaxDepth:
+			maxDepth = int(opt)
+		}
+	}
+
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	w := &pathWalker{o: newOptions(opts), naming: naming, maxDepth: maxDepth}
+	w.walk(t, "", 1)
+	return w.paths
+}
+
+type pathWalker struct {
+	o        *options
+	naming   Naming
+	maxDepth int
+	paths    []string
+}
+
+// walk appends the paths of the fields of the struct type `t` found at `path`.
+func (w *pathWalker) walk(t reflect.Type, path string, depth int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, ok := fieldNameFromTags(field, w.o.tagNames)
+		if !ok {
+			continue
+		}
+		fieldPath := joinPath(path, w.naming(name))
+
+		if _, ok := field.Tag.Lookup("protobuf_oneof"); ok && depth < w.maxDepth {
+			// The variants of the oneof are its sub fields.
+			for _, wrapper := range oneofFieldWrappers(t, field) {
+				wrapper = indirectType(wrapper)
+				if wrapper.Kind() == reflect.Struct {
+					w.walk(wrapper, fieldPath, depth+1)
+				}
+			}
+			continue
+		}
+
+		fieldType := indirectType(field.Type)
+		switch fieldType.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			fieldType = indirectType(fieldType.Elem())
+		}
+		if fieldType.Kind() != reflect.Struct || depth >= w.maxDepth || !hasFields(fieldType, w.o) {
+			w.paths = append(w.paths, fieldPath)
+			continue
+		}
+		w.walk(fieldType, fieldPath, depth+1)
+	}
+}
+
+// hasFields reports whether the struct type `t` has any fields the copying functions consider.
+func hasFields(t reflect.Type, o *options) bool {
+	return len(getFieldMappingFromTags(reflect.New(t).Elem(), false, o.tagNames)) > 0
+}
+
+// MaskFromRegex creates a Mask that selects the fields of the message type `t` whose names match the regular
+// expression `pattern`, e.g. "url$" selects all the fields ending in "url". The names resolved from the tags are
+// matched unless MatchGoNames(true) is given. Only the top level fields are matched by default: MaxDepth(n) makes
+// it match the fields of the nested messages up to n levels as well, the messages that match are selected entirely.
+func MaskFromRegex(t reflect.Type, pattern string, opts ...interface{}) (Mask, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pattern %s", pattern)
+	}
+
+	var (
+		maxDepth     = 1
+		matchGoNames bool
+	)
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case MaxDepth:
+			maxDepth = int(opt)
+
+		case MatchGoNames:
+			matchGoNames = bool(opt)
+		}
+	}
+
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("%s is not a message type", t)
+	}
+	return regexMask(t, re, matchGoNames, maxDepth, newOptions(opts)), nil
+}
+
+// regexMask returns the Mask of the fields of the struct type `t` that match `re`.
+func regexMask(t reflect.Type, re *regexp.Regexp, matchGoNames bool, depth int, o *options) Mask {
+	mask := make(Mask)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, ok := fieldNameFromTags(field, o.tagNames)
+		if !ok {
+			continue
+		}
+
+		matchName := name
+		if matchGoNames {
+			matchName = field.Name
+		}
+		if re.MatchString(matchName) {
+			mask[name] = Mask{}
+			continue
+		}
+
+		if fieldType := messageType(field.Type); depth > 1 && fieldType != nil {
+			if subMask := regexMask(fieldType, re, matchGoNames, depth-1, o); len(subMask) > 0 {
+				mask[name] = subMask
+			}
+		}
+	}
+	return mask
+}
@@ -0,0 +1,65 @@
+package fieldmask_utils_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/generator"
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllPaths(t *testing.T) {
+	paths := fieldmask_utils.AllPaths(reflect.TypeOf(&testproto.Image{}))
+	assert.Equal(t, []string{"original_url", "resized_url"}, paths)
+
+	paths = fieldmask_utils.AllPaths(reflect.TypeOf(testproto.User{}), fieldmask_utils.MaxDepth(1))
+	assert.Equal(t, []string{
+		"id", "username", "role", "meta", "deactivated", "permissions", "name", "details", "images", "avatar",
+		"tags", "friends", "photos",
+	}, paths)
+
+	paths = fieldmask_utils.AllPaths(reflect.TypeOf(testproto.User{}), fieldmask_utils.MaxDepth(2))
+	assert.Contains(t, paths, "name.male_name")
+	assert.Contains(t, paths, "name.profile")
+	assert.Contains(t, paths, "avatar.original_url")
+	assert.Contains(t, paths, "friends.friends")
+	assert.NotContains(t, paths, "friends.avatar.original_url")
+
+	paths = fieldmask_utils.AllPaths(reflect.TypeOf(testproto.User{}), fieldmask_utils.MaxDepth(3),
+		fieldmask_utils.Naming(generator.CamelCase))
+	assert.Contains(t, paths, "Name.Profile.DisplayName")
+	assert.Contains(t, paths, "Friends.Avatar.OriginalUrl")
+}
+
+func TestMaskFromRegex(t *testing.T) {
+	mask, err := fieldmask_utils.MaskFromRegex(reflect.TypeOf(&testproto.Image{}), "url$")
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("original_url,resized_url"), mask)
+
+	mask, err = fieldmask_utils.MaskFromRegex(reflect.TypeOf(&testproto.Image{}), "^Original",
+		fieldmask_utils.MatchGoNames(true))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("original_url"), mask)
+
+	// Only the top level fields are matched by default.
+	mask, err = fieldmask_utils.MaskFromRegex(reflect.TypeOf(&testproto.User{}), "url$")
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.Mask{}, mask)
+
+	mask, err = fieldmask_utils.MaskFromRegex(reflect.TypeOf(&testproto.User{}), "^(original_url|username)$",
+		fieldmask_utils.MaxDepth(2))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString(
+		"username,images{original_url},avatar{original_url},friends{username},photos{original_url}"), mask)
+
+	_, err = fieldmask_utils.MaskFromRegex(reflect.TypeOf(&testproto.User{}), "(")
+	assert.Error(t, err)
+}
+
+func TestAllPathsTwoOneofs(t *testing.T) {
+	paths := fieldmask_utils.AllPaths(reflect.TypeOf(&twoOneofs{}))
+	assert.Equal(t, []string{"a.a1", "a.a2", "b.b1"}, paths)
+}
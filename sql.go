@@ -0,0 +1,72 @@
+package fieldmask_utils
+
+import (
+	"database/sql"
+	"reflect"
+)
+
+// WithSQLNullAdapters registers the adapters (see WithAdapter) that copy the scalars and the pointers to scalars
+// to the sql.Null* dst fields: a value populates e.g. sql.NullString{String: v, Valid: true}, a nil pointer results
+// in an invalid (NULL) value. The supported types are:
+//
+//	string, *string                      → sql.NullString
+//	int64, int32, *int64, *int32         → sql.NullInt64
+//	float64, float32, *float64, *float32 → sql.NullFloat64
+//	bool, *bool                          → sql.NullBool
+func WithSQLNullAdapters() Option {
+	return func(o *options) {
+		for _, t := range []reflect.Type{reflect.TypeOf(""), reflect.TypeOf((*string)(nil))} {
+			WithAdapter(t, reflect.TypeOf(sql.NullString{}), func(src reflect.Value) (reflect.Value, error) {
+				v, ok := sqlNullSrc(src)
+				if !ok {
+					return reflect.ValueOf(sql.NullString{}), nil
+				}
+				return reflect.ValueOf(sql.NullString{String: v.String(), Valid: true}), nil
+			})(o)
+		}
+		for _, t := range []reflect.Type{
+			reflect.TypeOf(int64(0)), reflect.TypeOf(int32(0)),
+			reflect.TypeOf((*int64)(nil)), reflect.TypeOf((*int32)(nil)),
+		} {
+			WithAdapter(t, reflect.TypeOf(sql.NullInt64{}), func(src reflect.Value) (reflect.Value, error) {
+				v, ok := sqlNullSrc(src)
+				if !ok {
+					return reflect.ValueOf(sql.NullInt64{}), nil
+				}
+				return reflect.ValueOf(sql.NullInt64{Int64: v.Int(), Valid: true}), nil
+			})(o)
+		}
+		for _, t := range []reflect.Type{
+			reflect.TypeOf(float64(0)), reflect.TypeOf(float32(0)),
+			reflect.TypeOf((*float64)(nil)), reflect.TypeOf((*float32)(nil)),
+		} {
+			WithAdapter(t, reflect.TypeOf(sql.NullFloat64{}), func(src reflect.Value) (reflect.Value, error) {
+				v, ok := sqlNullSrc(src)
+				if !ok {
+					return reflect.ValueOf(sql.NullFloat64{}), nil
+				}
+				return reflect.ValueOf(sql.NullFloat64{Float64: v.Float(), Valid: true}), nil
+			})(o)
+		}
+		for _, t := range []reflect.Type{reflect.TypeOf(false), reflect.TypeOf((*bool)(nil))} {
+			WithAdapter(t, reflect.TypeOf(sql.NullBool{}), func(src reflect.Value) (reflect.Value, error) {
+				v, ok := sqlNullSrc(src)
+				if !ok {
+					return reflect.ValueOf(sql.NullBool{}), nil
+				}
+				return reflect.ValueOf(sql.NullBool{Bool: v.Bool(), Valid: true}), nil
+			})(o)
+		}
+	}
+}
+
+// sqlNullSrc dereferences the adapted `src` value. It returns false for nil pointers.
+func sqlNullSrc(src reflect.Value) (reflect.Value, bool) {
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return reflect.Value{}, false
+		}
+		return src.Elem(), true
+	}
+	return src, true
+}
@@ -0,0 +1,41 @@
+package fieldmask_utils_test
+
+import (
+	"database/sql"
+	"testing"
+
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructToStructWithSQLNullAdapters(t *testing.T) {
+	type UserRow struct {
+		Username sql.NullString `json:"username"`
+		Nickname sql.NullString `json:"nickname"`
+		Score    sql.NullInt64  `json:"score"`
+		Active   sql.NullBool   `json:"active"`
+	}
+	type User struct {
+		Username string  `json:"username"`
+		Nickname *string `json:"nickname"`
+		Score    int32   `json:"score"`
+		Active   *bool   `json:"active"`
+	}
+	active := true
+	src := &User{Username: "johnny", Score: 5, Active: &active}
+
+	dst := &UserRow{Nickname: sql.NullString{String: "stale", Valid: true}}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, src, dst, fieldmask_utils.WithSQLNullAdapters())
+	require.NoError(t, err)
+	assert.Equal(t, &UserRow{
+		Username: sql.NullString{String: "johnny", Valid: true},
+		Nickname: sql.NullString{},
+		Score:    sql.NullInt64{Int64: 5, Valid: true},
+		Active:   sql.NullBool{Bool: true, Valid: true},
+	}, dst)
+
+	// The adapters are opt-in.
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.MaskFromString("username"), testUserFull, &UserRow{})
+	assert.Error(t, err)
+}
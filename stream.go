@@ -0,0 +1,288 @@
+package fieldmask_utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// StructToJSONStream writes the JSON encoding of `src` filtered by `filter` to `w`. The output is the same as the
+// json.Marshal output of the map built by StructToMap with the same arguments, but the map is never built: the fields
+// are written to `w` while `src` is walked.
+func StructToJSONStream(filter FieldFilter, src interface{}, w io.Writer, opts ...interface{}) error {
+	o := newOptions(opts)
+	if isNil(src) {
+		if err := o.nilSrcError(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "{}")
+		return err
+	}
+
+	filter = o.rootFilter(filter)
+	if err := cycleError(filter); err != nil {
+		return err
+	}
+	s := &jsonStreamer{w: bufio.NewWriter(w), o: o}
+	if err := s.writeStruct(filter, src, ""); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return o.coverageError()
+}
+
+type jsonStreamer struct {
+	w *bufio.Writer
+	o *options
+}
+
+// jsonField is a single field of a JSON object: the value is written by `write`.
+type jsonField struct {
+	name  string
+	write func() error
+}
+
+func (s *jsonStreamer) writeStruct(filter FieldFilter, src interface{}, path string) error {
+	fields, err := s.collectFields(filter, src, path, nil)
+	if err != nil {
+		return err
+	}
+	// Encode the fields in the same order json.Marshal encodes the map keys. The last field wins if several fields
+	// have the same name, like in the map.
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+
+	s.w.WriteByte('{')
+	for i, field := range fields {
+		if i+1 < len(fields) && fields[i+1].name == field.name {
+			continue
+		}
+		if err := s.writeValue(field.name); err != nil {
+			return err
+		}
+		s.w.WriteByte(':')
+		if err := field.write(); err != nil {
+			return err
+		}
+		if i+1 < len(fields) {
+			s.w.WriteByte(',')
+		}
+	}
+	s.w.WriteByte('}')
+	return nil
+}
+
+// collectFields appends the fields of `src` selected by `filter` to `fields` the same way structToMap sets them
+// on the map.
+func (s *jsonStreamer) collectFields(filter FieldFilter, src interface{}, path string, fields []jsonField) (
+	[]jsonField, error) {
+	o := s.o
+	srcVal := indirect(reflect.ValueOf(src))
+	mapping := o.fieldMapping(srcVal, false)
+
+	for i := 0; i < srcVal.NumField(); i++ {
+		structField := srcVal.Type().Field(i)
+		fieldName, ok := mapping[structField.Name]
+		if !ok {
+			continue
+		}
+
+		subFilter, ok := filter.Filter(fieldName)
+		if ok && o.stopPaths != nil && o.stopPaths[joinPath(path, fieldName)] {
+			continue
+		}
+		if !ok {
+			// Skip this field.
+			if o.logger != nil || o.requireFullCoverage {
+				o.skip(joinPath(path, fieldName))
+			}
+			continue
+		}
+
+		fieldPath := joinPath(path, fieldName)
+		if isUnsupportedKind(structField.Type.Kind()) {
+			if o.errorOnUnsupported {
+				return nil, errors.Errorf("field %s of kind %s can not be copied", fieldPath, structField.Type.Kind())
+			}
+			continue
+		}
+
+		srcField, err := o.srcField(src, structField.Name)
+		if err != nil {
+			return nil, err
+		}
+		if srcField, err = o.applyDefault(srcField, fieldPath); err != nil {
+			return nil, err
+		}
+		if o.absent(structField, srcField) {
+			continue
+		}
+		if renamed, ok := o.keyRenames[fieldPath]; ok {
+			fieldName = renamed
+		}
+
+		if format, ok := o.formatter(srcField.Type()); ok {
+			fields = append(fields, s.valueField(fieldName, format(srcField)))
+			continue
+		}
+
+		if o.flattenOneof && srcField.Kind() == reflect.Interface {
+			if _, ok := structField.Tag.Lookup("protobuf_oneof"); ok {
+				if srcField.IsNil() {
+					continue
+				}
+				if fields, err = s.collectFields(subFilter, srcField.Interface(), fieldPath, fields); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		if o.nativeStructValues {
+			if v, ok := structValueToNative(subFilter, srcField.Interface()); ok {
+				fields = append(fields, s.valueField(fieldName, v))
+				continue
+			}
+		}
+
+		if o.isOpaque(srcField.Type()) {
+			fields = append(fields, s.valueField(fieldName, srcField.Interface()))
+			continue
+		}
+
+		switch srcField.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if srcField.IsNil() {
+				isMessage := srcField.Kind() == reflect.Ptr && srcField.Type().Elem().Kind() == reflect.Struct
+				if o.nilShape && isMessage && isDeepMask(subFilter) {
+					shape := nilMessageShape(subFilter, srcField.Type().Elem(), fieldPath, o)
+					fields = append(fields, s.valueField(fieldName, shape))
+				} else if o.nilAsEmptyMap && isMessage {
+					fields = append(fields, s.valueField(fieldName, map[string]interface{}{}))
+				} else {
+					fields = append(fields, s.valueField(fieldName, nil))
+				}
+				continue
+			}
+			if elem := indirect(srcField.Elem()); elem.Kind() != reflect.Struct {
+				fields = append(fields, s.valueField(fieldName, o.mapValue(elem)))
+				continue
+			}
+			fields = append(fields, jsonField{name: fieldName, write: func() error {
+				return s.writeStruct(subFilter, srcField.Interface(), fieldPath)
+			}})
+
+		case reflect.Array, reflect.Slice:
+			// Check if it is an array of values (non-pointers).
+			if srcField.Type().Elem().Kind() != reflect.Ptr {
+				if format, ok := o.formatter(srcField.Type().Elem()); ok && srcField.Len() > 0 {
+					v := make([]interface{}, srcField.Len())
+					for i := range v {
+						v[i] = format(srcField.Index(i))
+					}
+					fields = append(fields, s.valueField(fieldName, v))
+				} else if srcField.Len() > 0 {
+					fields = append(fields, s.valueField(fieldName, o.mapValue(srcField)))
+				} else {
+					fields = append(fields, s.valueField(fieldName, nil))
+				}
+				continue
+			}
+			fields = append(fields, jsonField{name: fieldName, write: func() error {
+				s.w.WriteByte('[')
+				for i := 0; i < srcField.Len(); i++ {
+					if i > 0 {
+						s.w.WriteByte(',')
+					}
+					if item := srcField.Index(i); item.Kind() == reflect.Ptr && item.IsNil() {
+						s.w.WriteString("null")
+						continue
+					}
+					if err := s.writeStruct(subFilter, srcField.Index(i).Interface(), fieldPath); err != nil {
+						return err
+					}
+				}
+				s.w.WriteByte(']')
+				return nil
+			}})
+
+		case reflect.Map:
+			if o.sortedMapEntries || indirectType(srcField.Type().Elem()).Kind() != reflect.Struct {
+				v, err := mapFieldToMap(subFilter, srcField, fieldPath, o)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, s.valueField(fieldName, v))
+				continue
+			}
+			if srcField.IsNil() {
+				fields = append(fields, s.valueField(fieldName, nil))
+				continue
+			}
+			fields = append(fields, jsonField{name: fieldName, write: func() error {
+				return s.writeMessageMap(subFilter, srcField, fieldPath)
+			}})
+
+		default:
+			fields = append(fields, s.valueField(fieldName, o.mapValue(srcField)))
+		}
+	}
+	return fields, nil
+}
+
+// writeMessageMap writes the map of messages `m` filtering every value with `filter`.
+func (s *jsonStreamer) writeMessageMap(filter FieldFilter, m reflect.Value, path string) error {
+	keys := m.MapKeys()
+	if excludesAll(filter) {
+		keys = nil
+	}
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = mapKeyString(key)
+	}
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return names[order[i]] < names[order[j]] })
+
+	s.w.WriteByte('{')
+	for i, index := range order {
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+		if err := s.writeValue(names[index]); err != nil {
+			return err
+		}
+		s.w.WriteByte(':')
+		value := m.MapIndex(keys[index])
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			s.w.WriteString("null")
+			continue
+		}
+		if err := s.writeStruct(filter, value.Interface(), path); err != nil {
+			return err
+		}
+	}
+	s.w.WriteByte('}')
+	return nil
+}
+
+// valueField returns a jsonField that writes the json.Marshal encoding of `v`.
+func (s *jsonStreamer) valueField(name string, v interface{}) jsonField {
+	return jsonField{name: name, write: func() error { return s.writeValue(v) }}
+}
+
+func (s *jsonStreamer) writeValue(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal a value to JSON")
+	}
+	_, err = s.w.Write(data)
+	return err
+}
@@ -0,0 +1,81 @@
+package fieldmask_utils_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructToJSONStream(t *testing.T) {
+	testCases := []struct {
+		filter fieldmask_utils.FieldFilter
+		opts   []interface{}
+	}{
+		{fieldmask_utils.Mask{}, nil},
+		{fieldmask_utils.MaskFromString("id,avatar{original_url},friends{id,username},tags"), nil},
+		{fieldmask_utils.MaskFromString("name{male_name},images"), nil},
+		{fieldmask_utils.MaskInverse{"friends": nil, "avatar": fieldmask_utils.MaskInverse{"resized_url": nil}}, nil},
+		{fieldmask_utils.MaskFromString("id,name"), []interface{}{fieldmask_utils.WithFlattenOneof()}},
+		{fieldmask_utils.MaskFromString("photos{resized_url}"), nil},
+		{fieldmask_utils.MaskFromString("meta,photos"), []interface{}{fieldmask_utils.WithSortedMapEntries()}},
+		{fieldmask_utils.Mask{}, []interface{}{fieldmask_utils.WithPresenceMap()}},
+		{fieldmask_utils.Mask{}, []interface{}{fieldmask_utils.WithOmitProtoDefaults()}},
+	}
+	src := proto.Clone(testUserFull).(*testproto.User)
+	src.Photos = map[string]*testproto.Image{
+		"b": {OriginalUrl: "b.jpg", ResizedUrl: "b_resized.jpg"},
+		"a": {OriginalUrl: "a.jpg"},
+		"c": nil,
+	}
+	for _, testCase := range testCases {
+		m := make(map[string]interface{})
+		require.NoError(t, fieldmask_utils.StructToMap(testCase.filter, src, m, testCase.opts...))
+		expected, err := json.Marshal(m)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = fieldmask_utils.StructToJSONStream(testCase.filter, src, &buf, testCase.opts...)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), buf.String(), testCase.filter)
+	}
+}
+
+func TestStructToJSONStreamNilMessages(t *testing.T) {
+	var buf bytes.Buffer
+	err := fieldmask_utils.StructToJSONStream(fieldmask_utils.MaskFromString("avatar{original_url},friends"),
+		&testproto.User{}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, `{"avatar":null,"friends":[]}`, buf.String())
+
+	buf.Reset()
+	err = fieldmask_utils.StructToJSONStream(fieldmask_utils.Mask{}, (*testproto.User)(nil), &buf)
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, buf.String())
+
+	// The nil elements of the repeated messages are null.
+	src := &testproto.User{Friends: []*testproto.User{nil, {Id: 2}}}
+	m := make(map[string]interface{})
+	require.NoError(t, fieldmask_utils.StructToMap(fieldmask_utils.MaskFromString("friends{id}"), src, m))
+	assert.Equal(t, []map[string]interface{}{nil, {"id": uint32(2)}}, m["friends"])
+	expected, err := json.Marshal(m)
+	require.NoError(t, err)
+
+	buf.Reset()
+	err = fieldmask_utils.StructToJSONStream(fieldmask_utils.MaskFromString("friends{id}"), src, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, `{"friends":[null,{"id":2}]}`, buf.String())
+	assert.Equal(t, string(expected), buf.String())
+}
+
+func TestStructToJSONStreamCyclicMask(t *testing.T) {
+	mask := fieldmask_utils.Mask{}
+	mask["friends"] = mask
+	var buf bytes.Buffer
+	assert.Error(t, fieldmask_utils.StructToJSONStream(mask, testUserFull, &buf))
+}
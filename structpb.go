@@ -0,0 +1,166 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/pkg/errors"
+)
+
+// structValueToNative converts the google.protobuf.Struct, Value and ListValue messages to the corresponding native
+// Go values: map[string]interface{}, []interface{}, string, float64, bool or nil.
+// The keys of the Struct messages are filtered with the given filter. It returns false if `v` is not one of these types.
+func structValueToNative(filter FieldFilter, v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case *structpb.Struct:
+		if v == nil {
+			return nil, true
+		}
+		result := make(map[string]interface{}, len(v.GetFields()))
+		for key, value := range v.GetFields() {
+			subFilter, ok := filter.Filter(key)
+			if !ok {
+				continue
+			}
+			result[key], _ = structValueToNative(subFilter, value)
+		}
+		return result, true
+
+	case *structpb.ListValue:
+		if v == nil {
+			return nil, true
+		}
+		result := make([]interface{}, len(v.GetValues()))
+		for i, value := range v.GetValues() {
+			result[i], _ = structValueToNative(filter, value)
+		}
+		return result, true
+
+	case *structpb.Value:
+		switch kind := v.GetKind().(type) {
+		case *structpb.Value_NumberValue:
+			return kind.NumberValue, true
+		case *structpb.Value_StringValue:
+			return kind.StringValue, true
+		case *structpb.Value_BoolValue:
+			return kind.BoolValue, true
+		case *structpb.Value_StructValue:
+			return structValueToNative(filter, kind.StructValue)
+		case *structpb.Value_ListValue:
+			return structValueToNative(filter, kind.ListValue)
+		default:
+			// Either NullValue or a nil Value.
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	structValueType = reflect.TypeOf((*structpb.Value)(nil))
+	structType      = reflect.TypeOf((*structpb.Struct)(nil))
+	listValueType   = reflect.TypeOf((*structpb.ListValue)(nil))
+)
+
+// WithStructValueAdapters registers the adapters (see WithAdapter) that copy the JSON-like src fields to the
+// google.protobuf.Struct family dst fields, which is the inverse of WithNativeStructValues:
+//
+//	string, bool, numbers, interface{}, maps and slices → *structpb.Value
+//	map[string]interface{}, map[string]string           → *structpb.Struct
+//	[]interface{}, []string                             → *structpb.ListValue
+//
+// Nil maps and slices result in nil dst messages, a nil interface{} results in a NullValue.
+func WithStructValueAdapters() Option {
+	valueTypes := []reflect.Type{
+		reflect.TypeOf(""), reflect.TypeOf(false),
+		reflect.TypeOf(float64(0)), reflect.TypeOf(float32(0)),
+		reflect.TypeOf(int64(0)), reflect.TypeOf(int32(0)), reflect.TypeOf(int(0)),
+		reflect.TypeOf(uint64(0)), reflect.TypeOf(uint32(0)), reflect.TypeOf(uint(0)),
+		reflect.TypeOf((*interface{})(nil)).Elem(),
+	}
+	structTypes := []reflect.Type{reflect.TypeOf(map[string]interface{}(nil)), reflect.TypeOf(map[string]string(nil))}
+	listTypes := []reflect.Type{reflect.TypeOf([]interface{}(nil)), reflect.TypeOf([]string(nil))}
+
+	return func(o *options) {
+		for _, t := range append(append(valueTypes, structTypes...), listTypes...) {
+			WithAdapter(t, structValueType, func(src reflect.Value) (reflect.Value, error) {
+				if (src.Kind() == reflect.Map || src.Kind() == reflect.Slice) && src.IsNil() {
+					return reflect.Zero(structValueType), nil
+				}
+				v, err := nativeToStructValue(src)
+				return reflect.ValueOf(v), err
+			})(o)
+		}
+		for _, t := range structTypes {
+			WithAdapter(t, structType, func(src reflect.Value) (reflect.Value, error) {
+				if src.IsNil() {
+					return reflect.Zero(structType), nil
+				}
+				v, err := nativeToStructValue(src)
+				return reflect.ValueOf(v.GetStructValue()), err
+			})(o)
+		}
+		for _, t := range listTypes {
+			WithAdapter(t, listValueType, func(src reflect.Value) (reflect.Value, error) {
+				if src.IsNil() {
+					return reflect.Zero(listValueType), nil
+				}
+				v, err := nativeToStructValue(src)
+				return reflect.ValueOf(v.GetListValue()), err
+			})(o)
+		}
+	}
+}
+
+// nativeToStructValue converts the native Go value `v` to a google.protobuf.Value. Maps must have string keys,
+// numbers are converted to float64.
+func nativeToStructValue(v reflect.Value) (*structpb.Value, error) {
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return &structpb.Value{Kind: &structpb.Value_NullValue{}}, nil
+		}
+		return nativeToStructValue(v.Elem())
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return &structpb.Value{Kind: &structpb.Value_NullValue{}}, nil
+	case reflect.String:
+		return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: v.String()}}, nil
+	case reflect.Bool:
+		return &structpb.Value{Kind: &structpb.Value_BoolValue{BoolValue: v.Bool()}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: float64(v.Int())}}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: float64(v.Uint())}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: v.Float()}}, nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, errors.Errorf("map keys of type %s can not be converted to a Struct", v.Type().Key())
+		}
+		fields := make(map[string]*structpb.Value, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := nativeToStructValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			fields[iter.Key().String()] = value
+		}
+		return &structpb.Value{Kind: &structpb.Value_StructValue{StructValue: &structpb.Struct{Fields: fields}}}, nil
+
+	case reflect.Slice, reflect.Array:
+		values := make([]*structpb.Value, v.Len())
+		for i := range values {
+			value, err := nativeToStructValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return &structpb.Value{Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{Values: values}}}, nil
+	}
+	return nil, errors.Errorf("value of type %s can not be converted to a Value", v.Type())
+}
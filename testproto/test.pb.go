@@ -125,6 +125,53 @@ func (m *Image) GetResizedUrl() string {
 	return ""
 }
 
+type Profile struct {
+	DisplayName          string   `protobuf:"bytes,1,opt,name=display_name,json=displayName,proto3" json:"display_name,omitempty"`
+	Avatar               *Image   `protobuf:"bytes,2,opt,name=avatar,proto3" json:"avatar,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Profile) Reset()         { *m = Profile{} }
+func (m *Profile) String() string { return proto.CompactTextString(m) }
+func (*Profile) ProtoMessage()    {}
+func (*Profile) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c161fcfdc0c3ff1e, []int{1}
+}
+
+func (m *Profile) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Profile.Unmarshal(m, b)
+}
+func (m *Profile) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Profile.Marshal(b, m, deterministic)
+}
+func (m *Profile) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Profile.Merge(m, src)
+}
+func (m *Profile) XXX_Size() int {
+	return xxx_messageInfo_Profile.Size(m)
+}
+func (m *Profile) XXX_DiscardUnknown() {
+	xxx_messageInfo_Profile.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Profile proto.InternalMessageInfo
+
+func (m *Profile) GetDisplayName() string {
+	if m != nil {
+		return m.DisplayName
+	}
+	return ""
+}
+
+func (m *Profile) GetAvatar() *Image {
+	if m != nil {
+		return m.Avatar
+	}
+	return nil
+}
+
 type Metrics struct {
 	Height               uint32   `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
 	Weight               uint32   `protobuf:"varint,2,opt,name=weight,proto3" json:"weight,omitempty"`
@@ -137,7 +184,7 @@ func (m *Metrics) Reset()         { *m = Metrics{} }
 func (m *Metrics) String() string { return proto.CompactTextString(m) }
 func (*Metrics) ProtoMessage()    {}
 func (*Metrics) Descriptor() ([]byte, []int) {
-	return fileDescriptor_c161fcfdc0c3ff1e, []int{1}
+	return fileDescriptor_c161fcfdc0c3ff1e, []int{2}
 }
 
 func (m *Metrics) XXX_Unmarshal(b []byte) error {
@@ -182,22 +229,24 @@ type User struct {
 	// Types that are valid to be assigned to Name:
 	//	*User_MaleName
 	//	*User_FemaleName
-	Name                 isUser_Name `protobuf_oneof:"name"`
-	Details              []*any.Any  `protobuf:"bytes,9,rep,name=details,proto3" json:"details,omitempty"`
-	Images               []*Image    `protobuf:"bytes,10,rep,name=images,proto3" json:"images,omitempty"`
-	Avatar               *Image      `protobuf:"bytes,11,opt,name=avatar,proto3" json:"avatar,omitempty"`
-	Tags                 []string    `protobuf:"bytes,12,rep,name=tags,proto3" json:"tags,omitempty"`
-	Friends              []*User     `protobuf:"bytes,13,rep,name=friends,proto3" json:"friends,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
-	XXX_unrecognized     []byte      `json:"-"`
-	XXX_sizecache        int32       `json:"-"`
+	//	*User_Profile
+	Name                 isUser_Name       `protobuf_oneof:"name"`
+	Details              []*any.Any        `protobuf:"bytes,9,rep,name=details,proto3" json:"details,omitempty"`
+	Images               []*Image          `protobuf:"bytes,10,rep,name=images,proto3" json:"images,omitempty"`
+	Avatar               *Image            `protobuf:"bytes,11,opt,name=avatar,proto3" json:"avatar,omitempty"`
+	Tags                 []string          `protobuf:"bytes,12,rep,name=tags,proto3" json:"tags,omitempty"`
+	Friends              []*User           `protobuf:"bytes,13,rep,name=friends,proto3" json:"friends,omitempty"`
+	Photos               map[string]*Image `protobuf:"bytes,15,rep,name=photos,proto3" json:"photos,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *User) Reset()         { *m = User{} }
 func (m *User) String() string { return proto.CompactTextString(m) }
 func (*User) ProtoMessage()    {}
 func (*User) Descriptor() ([]byte, []int) {
-	return fileDescriptor_c161fcfdc0c3ff1e, []int{2}
+	return fileDescriptor_c161fcfdc0c3ff1e, []int{3}
 }
 
 func (m *User) XXX_Unmarshal(b []byte) error {
@@ -272,10 +321,16 @@ type User_FemaleName struct {
 	FemaleName string `protobuf:"bytes,8,opt,name=female_name,json=femaleName,proto3,oneof"`
 }
 
+type User_Profile struct {
+	Profile *Profile `protobuf:"bytes,14,opt,name=profile,proto3,oneof"`
+}
+
 func (*User_MaleName) isUser_Name() {}
 
 func (*User_FemaleName) isUser_Name() {}
 
+func (*User_Profile) isUser_Name() {}
+
 func (m *User) GetName() isUser_Name {
 	if m != nil {
 		return m.Name
@@ -297,6 +352,13 @@ func (m *User) GetFemaleName() string {
 	return ""
 }
 
+func (m *User) GetProfile() *Profile {
+	if x, ok := m.GetName().(*User_Profile); ok {
+		return x.Profile
+	}
+	return nil
+}
+
 func (m *User) GetDetails() []*any.Any {
 	if m != nil {
 		return m.Details
@@ -332,11 +394,19 @@ func (m *User) GetFriends() []*User {
 	return nil
 }
 
+func (m *User) GetPhotos() map[string]*Image {
+	if m != nil {
+		return m.Photos
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*User) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*User_MaleName)(nil),
 		(*User_FemaleName)(nil),
+		(*User_Profile)(nil),
 	}
 }
 
@@ -352,7 +422,7 @@ func (m *UpdateUserRequest) Reset()         { *m = UpdateUserRequest{} }
 func (m *UpdateUserRequest) String() string { return proto.CompactTextString(m) }
 func (*UpdateUserRequest) ProtoMessage()    {}
 func (*UpdateUserRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_c161fcfdc0c3ff1e, []int{3}
+	return fileDescriptor_c161fcfdc0c3ff1e, []int{4}
 }
 
 func (m *UpdateUserRequest) XXX_Unmarshal(b []byte) error {
@@ -391,52 +461,59 @@ func init() {
 	proto.RegisterEnum("Role", Role_name, Role_value)
 	proto.RegisterEnum("Permission", Permission_name, Permission_value)
 	proto.RegisterType((*Image)(nil), "Image")
+	proto.RegisterType((*Profile)(nil), "Profile")
 	proto.RegisterType((*Metrics)(nil), "Metrics")
 	proto.RegisterType((*User)(nil), "User")
 	proto.RegisterMapType((map[string]string)(nil), "User.MetaEntry")
+	proto.RegisterMapType((map[string]*Image)(nil), "User.PhotosEntry")
 	proto.RegisterType((*UpdateUserRequest)(nil), "UpdateUserRequest")
 }
 
 func init() { proto.RegisterFile("test.proto", fileDescriptor_c161fcfdc0c3ff1e) }
 
 var fileDescriptor_c161fcfdc0c3ff1e = []byte{
-	// 597 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x93, 0xdf, 0x6f, 0xd3, 0x30,
-	0x10, 0xc7, 0x97, 0x36, 0xfd, 0x75, 0xd9, 0x46, 0xb0, 0x26, 0x94, 0x55, 0x82, 0x65, 0xe5, 0xa5,
-	0x1a, 0x5a, 0x26, 0x95, 0x87, 0x31, 0xde, 0x3a, 0x16, 0x60, 0x1a, 0x2d, 0xc8, 0x5a, 0x34, 0xc4,
-	0xcb, 0xe4, 0x35, 0xd7, 0xd4, 0x5a, 0x7e, 0x14, 0xdb, 0x19, 0x2a, 0xff, 0x32, 0xff, 0x04, 0xb2,
-	0x93, 0x76, 0x13, 0x3c, 0xc5, 0xf7, 0xb9, 0xaf, 0xcf, 0x17, 0x7f, 0x7d, 0x00, 0x0a, 0xa5, 0x0a,
-	0x96, 0xa2, 0x50, 0x45, 0x7f, 0x3f, 0x29, 0x8a, 0x24, 0xc5, 0x13, 0x13, 0xdd, 0x95, 0xf3, 0x13,
-	0x96, 0xaf, 0xea, 0x94, 0xff, 0x6f, 0x6a, 0xce, 0x31, 0x8d, 0x6f, 0x33, 0x26, 0xef, 0x2b, 0xc5,
-	0xe0, 0x0a, 0x5a, 0x97, 0x19, 0x4b, 0x90, 0x1c, 0xc2, 0x76, 0x21, 0x78, 0xc2, 0x73, 0x96, 0xde,
-	0x96, 0x22, 0xf5, 0x2c, 0xdf, 0x1a, 0xf6, 0xa8, 0xb3, 0x66, 0x91, 0x48, 0xc9, 0x01, 0x38, 0x02,
-	0x25, 0xff, 0x8d, 0xb1, 0x51, 0x34, 0x8c, 0x02, 0x6a, 0x14, 0x89, 0x74, 0x70, 0x06, 0x9d, 0x09,
-	0x2a, 0xc1, 0x67, 0x92, 0xbc, 0x80, 0xf6, 0x02, 0x79, 0xb2, 0x50, 0xa6, 0xd0, 0x0e, 0xad, 0x23,
-	0xcd, 0x7f, 0x55, 0xbc, 0x51, 0xf1, 0x2a, 0x1a, 0xfc, 0x69, 0x82, 0x1d, 0x49, 0x14, 0x64, 0x17,
-	0x1a, 0x3c, 0xae, 0x37, 0x35, 0x78, 0x4c, 0xfa, 0xd0, 0x2d, 0x25, 0x8a, 0x9c, 0x65, 0x58, 0x9f,
-	0xb8, 0x89, 0xc9, 0x3e, 0xd8, 0xa2, 0x48, 0xd1, 0x6b, 0xfa, 0xd6, 0x70, 0x77, 0xd4, 0x0a, 0x68,
-	0x91, 0x22, 0x35, 0x88, 0xbc, 0x06, 0x3b, 0x43, 0xc5, 0x3c, 0xdb, 0x6f, 0x0e, 0x9d, 0xd1, 0xb3,
-	0x40, 0xd7, 0x0e, 0x26, 0xa8, 0x58, 0x98, 0x2b, 0xb1, 0xa2, 0x26, 0x49, 0x7c, 0x70, 0x62, 0x64,
-	0x33, 0xc5, 0x1f, 0x98, 0xc2, 0xd8, 0x6b, 0xf9, 0xd6, 0xb0, 0x4b, 0x9f, 0x22, 0x72, 0x0c, 0xce,
-	0x12, 0x45, 0xc6, 0xa5, 0xe4, 0x45, 0x2e, 0xbd, 0xb6, 0xdf, 0x1c, 0xee, 0x8e, 0x9c, 0xe0, 0xdb,
-	0x86, 0xd1, 0xa7, 0x79, 0xf2, 0x12, 0x7a, 0x19, 0x4b, 0xf1, 0xd6, 0x74, 0xdb, 0xd1, 0xdd, 0x7e,
-	0xde, 0xa2, 0x5d, 0x8d, 0xa6, 0xba, 0xdf, 0x43, 0x70, 0xe6, 0xf8, 0x28, 0xe8, 0xd6, 0x02, 0xa8,
-	0xa0, 0x91, 0x04, 0xd0, 0x89, 0x51, 0x31, 0x9e, 0x4a, 0xaf, 0x67, 0x5a, 0xdf, 0x0b, 0x2a, 0x0f,
-	0x83, 0xb5, 0x87, 0xc1, 0x38, 0x5f, 0xd1, 0xb5, 0x88, 0xbc, 0x82, 0x36, 0xd7, 0xfe, 0x49, 0x0f,
-	0x8c, 0xbc, 0x1d, 0x18, 0x3b, 0x69, 0x4d, 0x75, 0x9e, 0x3d, 0x30, 0xc5, 0x84, 0xe7, 0xf8, 0xd6,
-	0xd3, 0x7c, 0x45, 0x09, 0x01, 0x5b, 0xb1, 0x44, 0x7a, 0xdb, 0x7e, 0x73, 0xd8, 0xa3, 0x66, 0x4d,
-	0x0e, 0xa0, 0x33, 0x17, 0x1c, 0xf3, 0x58, 0x7a, 0x3b, 0xa6, 0x68, 0xcb, 0x5c, 0x1f, 0x5d, 0xd3,
-	0xfe, 0x29, 0xf4, 0x36, 0x57, 0x49, 0x5c, 0x68, 0xde, 0xe3, 0xaa, 0x7e, 0x2f, 0x7a, 0x49, 0xf6,
-	0xa0, 0xf5, 0xc0, 0xd2, 0x72, 0xed, 0x57, 0x15, 0xbc, 0x6f, 0xbc, 0xb3, 0xce, 0xdb, 0x60, 0xeb,
-	0x3f, 0x1f, 0x70, 0x78, 0x1e, 0x2d, 0x63, 0xa6, 0xd0, 0xd4, 0xc5, 0x9f, 0x25, 0x4a, 0xa5, 0xdd,
-	0xd4, 0xce, 0x9a, 0x4a, 0x9b, 0x33, 0x0d, 0x22, 0x67, 0x00, 0x8f, 0x2f, 0xd7, 0x94, 0x75, 0x46,
-	0xfd, 0xff, 0x2e, 0xe6, 0xa3, 0x96, 0x4c, 0x98, 0xbc, 0xa7, 0xbd, 0xf9, 0x7a, 0x79, 0xf4, 0x06,
-	0x6c, 0xfd, 0x2c, 0x88, 0x03, 0x9d, 0x68, 0x7a, 0x35, 0xfd, 0x7a, 0x33, 0x75, 0xb7, 0x74, 0x40,
-	0xc3, 0x4f, 0xd1, 0x97, 0x31, 0x75, 0x2d, 0xd2, 0x83, 0xd6, 0xf8, 0x62, 0x72, 0x39, 0x75, 0x1b,
-	0x47, 0x01, 0xc0, 0xa3, 0xb5, 0xa4, 0x0b, 0x36, 0x0d, 0xc7, 0x17, 0xee, 0x96, 0x96, 0xdc, 0xd0,
-	0xcb, 0xeb, 0xd0, 0xb5, 0xf4, 0xd6, 0xf0, 0x7b, 0xf8, 0x21, 0xba, 0x0e, 0xdd, 0xc6, 0xf9, 0xd9,
-	0x8f, 0xd3, 0x84, 0xab, 0x45, 0x79, 0x17, 0xcc, 0x8a, 0x4c, 0x4f, 0xd9, 0x12, 0x85, 0xc2, 0xd9,
-	0x22, 0x2f, 0xd2, 0x22, 0xe1, 0x28, 0xab, 0x79, 0xd3, 0x4d, 0x1f, 0x97, 0x8a, 0xa7, 0xf2, 0x44,
-	0x8f, 0x6d, 0xd5, 0x6f, 0xdb, 0x7c, 0xde, 0xfe, 0x0d, 0x00, 0x00, 0xff, 0xff, 0x8a, 0x95, 0x47,
-	0xd9, 0xca, 0x03, 0x00, 0x00,
+	// 678 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x54, 0xdf, 0x4f, 0xdb, 0x3c,
+	0x14, 0xed, 0x8f, 0xf4, 0xd7, 0x0d, 0x94, 0x62, 0xa1, 0x4f, 0xa1, 0xfa, 0xbe, 0x8f, 0xd0, 0xed,
+	0xa1, 0x63, 0x22, 0x48, 0xdd, 0x03, 0x63, 0x6f, 0x65, 0x74, 0x03, 0x41, 0x3b, 0x64, 0x51, 0x31,
+	0xed, 0x05, 0x99, 0xe6, 0x36, 0xb5, 0xc8, 0x8f, 0xce, 0x76, 0x99, 0xba, 0x7f, 0x7e, 0x93, 0x9d,
+	0xa4, 0xad, 0x36, 0x9e, 0xe2, 0x7b, 0xee, 0xf1, 0xd1, 0xb5, 0xcf, 0x89, 0x01, 0x14, 0x4a, 0xe5,
+	0xcd, 0x45, 0xa2, 0x92, 0xf6, 0x7e, 0x90, 0x24, 0x41, 0x88, 0x27, 0xa6, 0x7a, 0x5c, 0x4c, 0x4f,
+	0x58, 0xbc, 0xcc, 0x5a, 0xee, 0x9f, 0xad, 0x29, 0xc7, 0xd0, 0x7f, 0x88, 0x98, 0x7c, 0x4a, 0x19,
+	0x9d, 0x6b, 0xa8, 0x5c, 0x45, 0x2c, 0x40, 0x72, 0x08, 0x5b, 0x89, 0xe0, 0x01, 0x8f, 0x59, 0xf8,
+	0xb0, 0x10, 0xa1, 0x53, 0x74, 0x8b, 0xdd, 0x06, 0xb5, 0x73, 0x6c, 0x2c, 0x42, 0x72, 0x00, 0xb6,
+	0x40, 0xc9, 0x7f, 0xa2, 0x6f, 0x18, 0x25, 0xc3, 0x80, 0x0c, 0x1a, 0x8b, 0xb0, 0x73, 0x03, 0xb5,
+	0x5b, 0x91, 0x4c, 0x79, 0x68, 0xe4, 0x7c, 0x2e, 0xe7, 0x21, 0x5b, 0x3e, 0xc4, 0x2c, 0xc2, 0x5c,
+	0x2e, 0xc3, 0x46, 0x2c, 0x42, 0xf2, 0x3f, 0x54, 0xd9, 0x33, 0x53, 0x4c, 0x18, 0x25, 0xbb, 0x57,
+	0xf5, 0xcc, 0x24, 0x34, 0x43, 0x3b, 0x67, 0x50, 0x1b, 0xa2, 0x12, 0x7c, 0x22, 0xc9, 0x3f, 0x50,
+	0x9d, 0x21, 0x0f, 0x66, 0xca, 0xe8, 0x6c, 0xd3, 0xac, 0xd2, 0xf8, 0x8f, 0x14, 0x2f, 0xa5, 0x78,
+	0x5a, 0x75, 0x7e, 0x59, 0x60, 0x8d, 0x25, 0x0a, 0xd2, 0x84, 0x12, 0xf7, 0xb3, 0x4d, 0x25, 0xee,
+	0x93, 0x36, 0xd4, 0x17, 0x12, 0x85, 0x19, 0x29, 0x9d, 0x7f, 0x55, 0x93, 0x7d, 0xb0, 0x44, 0x12,
+	0xa2, 0x53, 0x76, 0x8b, 0xdd, 0x66, 0xaf, 0xe2, 0xd1, 0x24, 0x44, 0x6a, 0x20, 0xf2, 0x0a, 0xac,
+	0x08, 0x15, 0x73, 0x2c, 0xb7, 0xdc, 0xb5, 0x7b, 0x3b, 0x9e, 0xd6, 0xf6, 0x86, 0xa8, 0xd8, 0x20,
+	0x56, 0x62, 0x49, 0x4d, 0x93, 0xb8, 0x60, 0xfb, 0xc8, 0x26, 0x8a, 0x3f, 0x33, 0x85, 0xbe, 0x53,
+	0x71, 0x8b, 0xdd, 0x3a, 0xdd, 0x84, 0xc8, 0x31, 0xd8, 0x73, 0x14, 0x11, 0x97, 0x92, 0x27, 0xb1,
+	0x74, 0xaa, 0x6e, 0xb9, 0xdb, 0xec, 0xd9, 0xde, 0xed, 0x0a, 0xa3, 0x9b, 0x7d, 0xf2, 0x1f, 0x34,
+	0x22, 0x16, 0x62, 0x7a, 0x81, 0x35, 0x3d, 0xed, 0x65, 0x81, 0xd6, 0x35, 0x64, 0xee, 0xef, 0x10,
+	0xec, 0x29, 0xae, 0x09, 0xf5, 0x8c, 0x00, 0x53, 0x5c, 0x51, 0x5e, 0x43, 0x6d, 0x9e, 0x1a, 0xe2,
+	0x34, 0xcd, 0x1d, 0xd7, 0xbd, 0xcc, 0xa0, 0xcb, 0x02, 0xcd, 0x5b, 0xc4, 0x83, 0x9a, 0x8f, 0x8a,
+	0xf1, 0x50, 0x3a, 0x0d, 0x73, 0xc0, 0x3d, 0x2f, 0xcd, 0x8d, 0x97, 0xe7, 0xc6, 0xeb, 0xc7, 0x4b,
+	0x9a, 0x93, 0xb4, 0x71, 0x5c, 0x3b, 0x25, 0x1d, 0x70, 0xcb, 0x9b, 0xc6, 0xa5, 0xe8, 0x86, 0xb1,
+	0xf6, 0x4b, 0xc6, 0x12, 0x02, 0x96, 0x62, 0x81, 0x74, 0xb6, 0xdc, 0x72, 0xb7, 0x41, 0xcd, 0x9a,
+	0x1c, 0x40, 0x6d, 0x2a, 0x38, 0xc6, 0xbe, 0x74, 0xb6, 0x8d, 0x68, 0xc5, 0x5c, 0x32, 0xcd, 0x51,
+	0xf2, 0x06, 0xaa, 0xf3, 0x59, 0xa2, 0x12, 0xe9, 0xec, 0x98, 0xfe, 0x6e, 0x6a, 0xc2, 0xad, 0xc1,
+	0x52, 0x1b, 0x32, 0x42, 0xfb, 0x14, 0x1a, 0x2b, 0x6f, 0x48, 0x0b, 0xca, 0x4f, 0xb8, 0xcc, 0xf2,
+	0xa7, 0x97, 0x64, 0x0f, 0x2a, 0xcf, 0x2c, 0x5c, 0xe4, 0x01, 0x48, 0x8b, 0x0f, 0xa5, 0xf7, 0xc5,
+	0x76, 0x1f, 0xec, 0x0d, 0xbd, 0x17, 0xb6, 0xfe, 0xbb, 0xb9, 0x75, 0x7d, 0xb0, 0xb5, 0xc4, 0x79,
+	0x15, 0x2c, 0xed, 0x46, 0x87, 0xc3, 0xee, 0x78, 0xee, 0x33, 0x85, 0xe6, 0x14, 0xf8, 0x7d, 0x81,
+	0x52, 0xe9, 0x84, 0xe9, 0xb4, 0x19, 0xc5, 0xd5, 0x09, 0x0d, 0x44, 0xce, 0x00, 0xd6, 0xff, 0x66,
+	0x26, 0xdf, 0xfe, 0xcb, 0x86, 0x4f, 0x9a, 0x32, 0x64, 0xf2, 0x89, 0x36, 0xa6, 0xf9, 0xf2, 0xe8,
+	0x2d, 0x58, 0x3a, 0xaa, 0xc4, 0x86, 0xda, 0x78, 0x74, 0x3d, 0xfa, 0x72, 0x3f, 0x6a, 0x15, 0x74,
+	0x41, 0x07, 0x9f, 0xc7, 0x37, 0x7d, 0xda, 0x2a, 0x92, 0x06, 0x54, 0xfa, 0x17, 0xc3, 0xab, 0x51,
+	0xab, 0x74, 0xe4, 0x01, 0xac, 0xe3, 0x46, 0xea, 0x60, 0xd1, 0x41, 0xff, 0xa2, 0x55, 0xd0, 0x94,
+	0x7b, 0x7a, 0x75, 0x37, 0x68, 0x15, 0xf5, 0xd6, 0xc1, 0xd7, 0xc1, 0xc7, 0xf1, 0xdd, 0xa0, 0x55,
+	0x3a, 0x3f, 0xfb, 0x76, 0x1a, 0x70, 0x35, 0x5b, 0x3c, 0x7a, 0x93, 0x24, 0xd2, 0xef, 0xc8, 0x1c,
+	0x85, 0xc2, 0xc9, 0x2c, 0x4e, 0xc2, 0x24, 0xe0, 0x28, 0xd3, 0x17, 0x45, 0x0f, 0x7d, 0xbc, 0x50,
+	0x3c, 0x94, 0x27, 0xfa, 0x61, 0x4a, 0xe7, 0xad, 0x9a, 0xcf, 0xbb, 0xdf, 0x03, 0x00, 0xe3, 0x9f,
+	0x6e, 0xaa, 0xac, 0x04, 0x00, 0x00,
 }
@@ -0,0 +1,41 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/pkg/errors"
+)
+
+// WithTimestampAdapters registers the adapters (see WithAdapter) that copy the *timestamp.Timestamp src fields to the
+// time.Time dst fields and vice versa. A nil timestamp results in a zero time.Time, a zero time.Time results in a nil
+// timestamp.
+func WithTimestampAdapters() Option {
+	timestampType := reflect.TypeOf((*timestamp.Timestamp)(nil))
+	timeType := reflect.TypeOf(time.Time{})
+	return func(o *options) {
+		WithAdapter(timestampType, timeType, func(src reflect.Value) (reflect.Value, error) {
+			if src.IsNil() {
+				return reflect.ValueOf(time.Time{}), nil
+			}
+			t, err := ptypes.Timestamp(src.Interface().(*timestamp.Timestamp))
+			if err != nil {
+				return reflect.Value{}, errors.Wrap(err, "failed to convert a timestamp to time.Time")
+			}
+			return reflect.ValueOf(t), nil
+		})(o)
+		WithAdapter(timeType, timestampType, func(src reflect.Value) (reflect.Value, error) {
+			t := src.Interface().(time.Time)
+			if t.IsZero() {
+				return reflect.Zero(timestampType), nil
+			}
+			ts, err := ptypes.TimestampProto(t)
+			if err != nil {
+				return reflect.Value{}, errors.Wrap(err, "failed to convert time.Time to a timestamp")
+			}
+			return reflect.ValueOf(ts), nil
+		})(o)
+	}
+}
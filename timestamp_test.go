@@ -0,0 +1,52 @@
+package fieldmask_utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructToStructWithTimestampAdapters(t *testing.T) {
+	type Event struct {
+		Name      string               `json:"name"`
+		CreatedAt *timestamp.Timestamp `json:"created_at"`
+	}
+	type EventRow struct {
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	ts := &timestamp.Timestamp{}
+	require.NoError(t, ptypes.UnmarshalAny(testUserFull.Details[0], ts))
+
+	row := &EventRow{}
+	err := fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &Event{Name: "signup", CreatedAt: ts}, row,
+		fieldmask_utils.WithTimestampAdapters())
+	require.NoError(t, err)
+	assert.Equal(t, &EventRow{Name: "signup", CreatedAt: time.Unix(5, 6).UTC()}, row)
+
+	event := &Event{}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, row, event, fieldmask_utils.WithTimestampAdapters())
+	require.NoError(t, err)
+	assert.Equal(t, &Event{Name: "signup", CreatedAt: &timestamp.Timestamp{Seconds: 5, Nanos: 6}}, event)
+
+	// A nil timestamp is copied as a zero time and vice versa.
+	row = &EventRow{CreatedAt: time.Now()}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &Event{}, row, fieldmask_utils.WithTimestampAdapters())
+	require.NoError(t, err)
+	assert.True(t, row.CreatedAt.IsZero())
+
+	event = &Event{CreatedAt: ts}
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &EventRow{}, event,
+		fieldmask_utils.WithTimestampAdapters())
+	require.NoError(t, err)
+	assert.Nil(t, event.CreatedAt)
+
+	// The adapters are opt-in.
+	err = fieldmask_utils.StructToStruct(fieldmask_utils.Mask{}, &Event{CreatedAt: ts}, &EventRow{})
+	assert.Error(t, err)
+}
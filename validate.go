@@ -0,0 +1,115 @@
+package fieldmask_utils
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/pkg/errors"
+)
+
+// MaskFromProtoFieldMaskValidated creates a Mask from the given FieldMask same as MaskFromProtoFieldMask and makes
+// sure every path of the mask is present in the message type `msgType`. The field names are resolved from the struct
+// tags the same way the copying functions do, so the mask is guaranteed to be applicable to `msgType`.
+func MaskFromProtoFieldMaskValidated(fm *types.FieldMask, msgType reflect.Type, opts ...interface{}) (Mask, error) {
+	mask, err := MaskFromProtoFieldMask(fm, opts...)
+	if err != nil {
+		return nil, err
+	}
+	msgType = indirectType(msgType)
+	if msgType.Kind() != reflect.Struct {
+		return nil, errors.Errorf("%s is not a message type", msgType)
+	}
+	if err := validateMask(mask, msgType, "", newOptions(opts)); err != nil {
+		return nil, err
+	}
+	return mask, nil
+}
+
+// validateMask returns an error for the first (in alphabetical order) path of `mask` that is not present in the
+// struct type `t`.
+func validateMask(mask Mask, t reflect.Type, path string, o *options) error {
+	fields := o.fieldMapping(reflect.New(t).Elem(), true)
+
+	fieldNames := make([]string, 0, len(mask))
+	for fieldName := range mask {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+
+	for _, fieldName := range fieldNames {
+		if fieldName == recursiveWildcard {
+			continue
+		}
+		fieldPath := joinPath(path, fieldName)
+		goName, ok := fields[fieldName]
+		if !ok {
+			return errors.Errorf("field %s is not present in %s", fieldPath, t)
+		}
+		subMask, _ := mask[fieldName].(Mask)
+		if len(subMask) == 0 {
+			continue
+		}
+
+		field, _ := t.FieldByName(goName)
+		if _, ok := field.Tag.Lookup("protobuf_oneof"); ok {
+			if err := validateOneof(subMask, t, field, fieldPath, o); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fieldType := indirectType(field.Type)
+		switch fieldType.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			fieldType = indirectType(fieldType.Elem())
+		}
+		if fieldType.Kind() != reflect.Struct {
+			return errors.Errorf("field %s of type %s has no sub fields", fieldPath, field.Type)
+		}
+		if err := validateMask(subMask, fieldType, fieldPath, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateOneof validates the `mask` of the variants of the oneof `field` of the message type `t`.
+func validateOneof(mask Mask, t reflect.Type, field reflect.StructField, path string, o *options) error {
+	variants := make(map[string]reflect.StructField)
+	for _, wrapper := range oneofFieldWrappers(t, field) {
+		wrapper = indirectType(wrapper)
+		if wrapper.Kind() != reflect.Struct || wrapper.NumField() != 1 {
+			continue
+		}
+		for name, goName := range o.fieldMapping(reflect.New(wrapper).Elem(), true) {
+			variants[name], _ = wrapper.FieldByName(goName)
+		}
+	}
+
+	fieldNames := make([]string, 0, len(mask))
+	for fieldName := range mask {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+
+	for _, fieldName := range fieldNames {
+		fieldPath := joinPath(path, fieldName)
+		variant, ok := variants[fieldName]
+		if !ok {
+			return errors.Errorf("field %s is not present in %s", fieldPath, t)
+		}
+		subMask, _ := mask[fieldName].(Mask)
+		if len(subMask) == 0 {
+			continue
+		}
+		fieldType := indirectType(variant.Type)
+		if fieldType.Kind() != reflect.Struct {
+			return errors.Errorf("field %s of type %s has no sub fields", fieldPath, variant.Type)
+		}
+		if err := validateMask(subMask, fieldType, fieldPath, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package fieldmask_utils_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	fieldmask_utils "github.com/propertechnologies/fieldmask-utils"
+	"github.com/propertechnologies/fieldmask-utils/testproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskFromProtoFieldMaskValidated(t *testing.T) {
+	fm := &types.FieldMask{Paths: []string{"id", "avatar.original_url", "friends.username", "name.profile.avatar"}}
+	mask, err := fieldmask_utils.MaskFromProtoFieldMaskValidated(fm, reflect.TypeOf(&testproto.User{}))
+	require.NoError(t, err)
+	assert.Equal(t,
+		fieldmask_utils.MaskFromString("id,avatar{original_url},friends{username},name{profile{avatar}}"), mask)
+}
+
+func TestMaskFromProtoFieldMaskValidatedFail(t *testing.T) {
+	testCases := []struct {
+		paths []string
+		err   string
+	}{
+		{[]string{"id", "bogus"}, "field bogus is not present"},
+		{[]string{"avatar.bogus"}, "field avatar.bogus is not present"},
+		{[]string{"name.bogus_name"}, "field name.bogus_name is not present"},
+		{[]string{"username.length"}, "field username of type string has no sub fields"},
+	}
+	for _, testCase := range testCases {
+		_, err := fieldmask_utils.MaskFromProtoFieldMaskValidated(
+			&types.FieldMask{Paths: testCase.paths}, reflect.TypeOf(testproto.User{}))
+		require.Error(t, err, testCase.paths)
+		assert.Contains(t, err.Error(), testCase.err)
+	}
+}
+
+func TestMaskFromProtoFieldMaskValidatedTwoOneofs(t *testing.T) {
+	fm := &types.FieldMask{Paths: []string{"a.a1", "b.b1"}}
+	mask, err := fieldmask_utils.MaskFromProtoFieldMaskValidated(fm, reflect.TypeOf(&twoOneofs{}))
+	require.NoError(t, err)
+	assert.Equal(t, fieldmask_utils.MaskFromString("a{a1},b{b1}"), mask)
+
+	// The variants of another oneof are rejected.
+	fm = &types.FieldMask{Paths: []string{"a.b1", "b.a1"}}
+	_, err = fieldmask_utils.MaskFromProtoFieldMaskValidated(fm, reflect.TypeOf(&twoOneofs{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field a.b1 is not present")
+}